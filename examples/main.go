@@ -31,41 +31,100 @@ import (
 	"flag"
 	"fmt"
 	"math"
+	"os"
+	"strconv"
+	"strings"
 )
 
-var Gungnir_density = []float64{0.5, 0.6, 0.7, 0.8, 0.9}
-var Trit_density = []float64{0.87, 0.99, 1.11, 1.23, 1.35, 1.45}
-
-const (
-	Gungnir_Min_Density = 0.5
-	Gungnir_Max_Density = 0.9
-	Trit_Min_Density    = 0.5
-	Trit_Max_Density    = 1.5
-)
+// splitList splits a comma separated flag, or gives def when it is empty.
+func splitList(list string, def string) []string {
+	if strings.TrimSpace(list) == "" {
+		return []string{def}
+	}
+	res := strings.Split(list, ",")
+	for i := range res {
+		res[i] = strings.TrimSpace(res[i])
+	}
+	return res
+}
 
+func parseFloats(list []string) ([]float64, error) {
+	res := make([]float64, len(list))
+	for i, v := range list {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = f
+	}
+	return res, nil
+}
 
-func validateDensity(density float64, option string) bool {
-	if option == "Gungnir-Trit" {
-		return density >= Trit_Min_Density && density <= Trit_Max_Density
-	} else {
-		return density >= Gungnir_Min_Density && density <= Gungnir_Max_Density
+func parseInts(list []string) ([]int64, error) {
+	res := make([]int64, len(list))
+	for i, v := range list {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = n
 	}
+	return res, nil
+}
+
+// fail prints the error to stderr and exits with status 1.
+func fail(a ...interface{}) {
+	fmt.Fprintln(os.Stderr, a...)
+	os.Exit(1)
 }
 
 func main() {
 
-	information_density_ := flag.Float64("density", 0.8, "Bits/Base")
+	information_density_ := flag.Float64("density", 0.8, "Bits/Base (Decode and Reconstruction read it from the manifest, and need the manifest unless option, density or length is given)")
 	Subrate_ := flag.Float64("sub", 0.01, "Substitution Error Rate")
 	Insrate_ := flag.Float64("ins", 0.01, "Insertion Error Rate")
 	Delrate_ := flag.Float64("del", 0.01, "Deletion Error Rate")
-	DNALength_ := flag.Int("length", 100, "Length of DNA sequence")
-	Option_ := flag.String("option", "Gungnir", "Gungnir, Gungnir-ONT or Gungnir-Trit")
-	Action_ := flag.String("action", "Encode", "Encode, AddNoise, Decode or Reconstruction")
-	Input_ := flag.String("input", "../files/The Ugly Duckling", "File to be encoded")
+	Flip_ := flag.Float64("flip", 0, "Share of reads AddNoise turns into their reverse complement")
+	Noise_ := flag.String("noise", "uniform", "AddNoise errors: uniform (the sub, ins and del rates of all bases, spread evenly), bernoulli (the same rates for each base on its own) or kmer (rates of the k-mer error profile)")
+	Burst_ := flag.Float64("burst", 1, "AddNoise and Simulate with bernoulli or kmer noise: mean length of a run of errors")
+	Homopolymer_ := flag.Float64("homopolymer", 0, "AddNoise and Simulate with bernoulli or kmer noise: chance per extra base of a homopolymer run to read it one base longer or shorter")
+	Ends_ := flag.Float64("ends", 1, "AddNoise and Simulate with bernoulli or kmer noise: error rate of the read ends, times that of the middle")
+	Seed_ := flag.Int64("seed", 1, "Seed of AddNoise and Simulate; the same seed gives the same reads")
+	Scale_ := flag.Float64("scale", 1, "Factor on the error rates of the k-mer error profile for AddNoise with -noise kmer")
+	Coverage_ := flag.Float64("coverage", 0, "Mean reads per strand; AddNoise then writes them to Reads for Cluster (Simulate: 10 if 0)")
+	Synth_ := flag.Float64("synth", 0.004, "Simulate: synthesis error rate per base, half deletions and a quarter each substitutions and insertions")
+	Truncate_ := flag.Float64("truncate", 0.05, "Simulate: share of synthesized molecules that stop early")
+	Dropout_ := flag.Float64("dropout", 0.01, "Simulate: share of strands lost")
+	PCR_ := flag.Int("pcr", 15, "Simulate: PCR cycles")
+	PCRSpread_ := flag.Float64("pcrsd", 0.05, "Simulate: spread of PCR efficiency between molecules")
+	Dist_ := flag.String("dist", "poisson", "Simulate: reads per strand, poisson or gamma (more strands with few reads)")
+	Chimera_ := flag.Float64("chimera", 0, "Simulate: share of chimeric reads")
+	DNALength_ := flag.Int("length", 100, "Length of DNA sequence (Decode and Reconstruction read it from the manifest)")
+	Option_ := flag.String("option", "Gungnir", "Gungnir, Gungnir-ONT or Gungnir-Trit (Decode and Reconstruction read it from the manifest)")
+	Action_ := flag.String("action", "Encode", "Encode, AddNoise, Trim, Cluster, Decode, Reconstruction, Retrieve, Mix, Route, Profile, Simulate or Benchmark")
+	Input_ := flag.String("input", "../files/The Ugly Duckling", "File or directory to be encoded (Mix and Route: directory of sub-pools; Trim, Cluster and Profile: FASTA reads)")
+	Path_ := flag.String("path", "", "File to retrieve from an archive (Route: the only sub-pool to amplify; Profile: directory to write the profile to)")
 	Output_ := flag.String("output", "../newfile", "Path for output")
 	MaxSeqNum_ := flag.Int("seqnum", -1, "Maximum number of sequences allowed to be generated")
+	Group_ := flag.Int("group", 32, "Data strands per Reed-Solomon group")
+	Parity_ := flag.Int("parity", 0, "Reed-Solomon parity strands per group (0 disables the outer code)")
+	Fountain_ := flag.Bool("fountain", false, "Encode droplets of a fountain code, seqnum sets how many")
+	Extend_ := flag.Bool("extend", false, "Append seqnum more droplets to the fountain pool in output")
+	Forward_ := flag.String("forward", "", "Forward primer attached to every strand")
+	Reverse_ := flag.String("reverse", "", "Reverse primer, its reverse complement ends every strand")
+	Flank_ := flag.Int("flank", 0, "Read bases before and after the strand that Decode and Retrieve skip free")
+	Score_ := flag.String("score", "edit", "Decode edit costs: edit (unit costs) or kmer (log-likelihood in the k-mer error profile)")
+	Profile_ := flag.String("profile", "", "Directory or JSON file of the k-mer error profile (default: the embedded HG002 ONT profile)")
 	EDmax_ := flag.Int("EDmax", 100, "Maximum Edit distance allowed")
+	Confidence_ := flag.Float64("confidence", 0, "Decode: least confidence, from 0 to 1, to emit a strand when other strands also explain the read")
+	Manifest_ := flag.Bool("manifest", true, "Decode: search the reads for the manifest (false decodes with option, density and length)")
+	Joint_ := flag.Bool("joint", false, "Decode all reads of each cluster together (run Cluster first)")
 	DecodeOption_ := flag.Bool("DecodeEDmax", true, "Whether using advancing EDmax for decoding (ignore EDmax if true)")
+	Options_ := flag.String("options", "", "Benchmark: comma separated options (default: option)")
+	Densities_ := flag.String("densities", "", "Benchmark: comma separated densities (default: density)")
+	Lengths_ := flag.String("lengths", "", "Benchmark: comma separated strand lengths (default: length)")
+	Errors_ := flag.String("errors", "", "Benchmark: comma separated error rates, split evenly into sub, ins and del (default: sub+ins+del)")
+	Seeds_ := flag.String("seeds", "", "Benchmark: comma separated seeds (default: seed)")
 	threads_num1_ := flag.Int("thread1", 1, "Sequences processed in parallel")
 	threads_num2_ := flag.Int("thread2", 1, "Threads for each Sequences")
 
@@ -75,79 +134,68 @@ func main() {
 	seqlen := *DNALength_
 	density := *information_density_
 
-	var config, PayloadLen, HashLen int
-	if option == "Gungnir" {
-		config = tools.Gungnir_Default_Params
-		if !validateDensity(density, option) {
-			fmt.Printf("Invalid Information Density! For Gungnir, density should be in range [%.2f, %.2f]\n",
-				Gungnir_Min_Density, Gungnir_Max_Density)
-			return
-		}
-		PayloadLen = int(math.Round(float64(seqlen) * density))
-		HashLen = seqlen - PayloadLen
-		if HashLen < 0 {
-			fmt.Printf("Error: Hash length cannot be negative! Density too high for length %d\n", seqlen)
-			return
-		}
-	} else if option == "Gungnir-ONT" {
-		config = tools.Gungnir_ONT_Params
-		if !validateDensity(density, option) {
-			fmt.Printf("Invalid Information Density! For Gungnir-ONT, density should be in range [%.2f, %.2f]\n",
-				Gungnir_Min_Density, Gungnir_Max_Density)
-			return
-		}
-		PayloadLen = int(math.Round(float64(seqlen) * density))
-		HashLen = seqlen - PayloadLen
-		if HashLen < 0 {
-			fmt.Printf("Error: Hash length cannot be negative! Density too high for length %d\n", seqlen)
-			return
-		}
-	} else if option == "Gungnir-Trit" {
-		config = tools.Gungnir_Trit_Params
-		if !validateDensity(density, option) {
-			fmt.Printf("Invalid Information Density! For Gungnir-Trit, density should be in range [%.2f, %.2f]\n",
-				Trit_Min_Density, Trit_Max_Density)
-			return
-		}
-		// Calculate max bits capacity for given DNA length
-		maxCapacity := (seqlen * 11) / 7
-		// Get closest standard density
-		PayloadLen = int(math.Round(float64(seqlen) * density))
-
-		// Check if requested payload exceeds max capacity
-		if PayloadLen > maxCapacity {
-			fmt.Printf("Error: Information density too high! Maximum payload for %d nt is %d bits (%.2f bits/nt)\n",
-				seqlen, maxCapacity, float64(maxCapacity)/float64(seqlen))
-			fmt.Printf("Requested payload: %d bits (%.2f bits/nt)\n", PayloadLen, density)
-			return
-		}
+	compiled, cerr := tools.SizeParams(option, density, seqlen)
+	if cerr != nil {
+		fail(cerr)
+	}
+	if actual := float64(compiled.PayloadLen) / float64(seqlen); math.Abs(actual-density) > 0.01 {
+		fmt.Printf("Note: Requested density %.2f bits/nt, actual density %.2f bits/nt (payload=%d bits, length=%d nt)\n",
+			density, actual, compiled.PayloadLen, seqlen)
+	}
 
-		HashLen = maxCapacity - PayloadLen
+	if *Group_ < 1 || *Group_ > tools.OuterMaxNum || *Parity_ < 0 || *Parity_ > tools.OuterMaxNum {
+		fail(fmt.Sprintf("Invalid Reed-Solomon group! group should be in range [1, %d] and parity in range [0, %d]",
+			tools.OuterMaxNum, tools.OuterMaxNum))
+	}
+	outer := tools.OuterCode{DataNum: *Group_, ParityNum: *Parity_}
 
-		// make sure HashLen is non-negative
-		if HashLen < 0 {
-			fmt.Printf("Error: Hash length cannot be negative! Density too high for length %d\n", seqlen)
-			return
-		}
+	primers := tools.PrimerPair{Forward: *Forward_, Reverse: *Reverse_}
+	if (primers.Forward != "" || primers.Reverse != "") && (!tools.ValidPrimer(primers.Forward) || !tools.ValidPrimer(primers.Reverse)) {
+		fail(fmt.Sprintf("Invalid primers! Both forward and reverse primers are needed, with at least %d bases of A, C, G and T",
+			tools.MinPrimerLen))
+	}
+
+	if *Flank_ < 0 || *Flank_ > tools.MaxFlankLenFree {
+		fail(fmt.Sprintf("Invalid flank! flank should be in range [0, %d]", tools.MaxFlankLenFree))
+	}
 
-		// Calculate actual information density
-		actualDensity := float64(PayloadLen) / float64(seqlen)
-		if math.Abs(actualDensity-density) > 0.01 {
-			fmt.Printf("Note: Requested density %.2f bits/nt, actual density %.2f bits/nt (payload=%d bits, length=%d nt)\n",
-				density, actualDensity, PayloadLen, seqlen)
+	if err := tools.SetProfile(*Profile_); err != nil {
+		fail(err)
+	}
+
+	if *Action_ == "Decode" && *Joint_ && *Score_ != "edit" {
+		fail("Invalid score! Decode with -joint counts every edit as one, use -score edit")
+	}
+	if *Action_ == "Decode" && *Joint_ && *Flank_ != 0 {
+		fail("Invalid flank! Decode with -joint expects trimmed reads, use -flank 0")
+	}
+	var scoring *tools.KmerCost
+	if *Score_ == "kmer" {
+		data, _, perr := tools.Readjson()
+		if perr != nil {
+			fail(perr)
 		}
-	} else {
-		fmt.Println("Invalid Option!")
-		return
+		scoring = tools.NewKmerCost(data)
+	} else if *Score_ != "edit" {
+		fail("Invalid score! score should be edit or kmer")
 	}
 
-	paramsRaw := tools.GenParamsRaw(HashLen, PayloadLen)
-	params := paramsRaw.Compile(config)
+	if *Confidence_ < 0 || *Confidence_ > 1 {
+		fail("Invalid confidence! confidence should be in range [0, 1]")
+	}
+	// Decode and Reconstruction need the manifest unless the code is given
+	defaulted := *Manifest_
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "option" || f.Name == "density" || f.Name == "length" {
+			defaulted = false
+		}
+	})
+	params := compiled.WithFlank(*Flank_).WithScoring(scoring).WithConfidence(*Confidence_).WithDefaulted(defaulted).WithSkipManifest(!*Manifest_)
 
 	sub := *Subrate_
 	ins := *Insrate_
 	del := *Delrate_
-	err := sub + ins + del
+	rate := sub + ins + del
 	action := *Action_
 	maxseq := *MaxSeqNum_
 	edmax := *EDmax_
@@ -155,20 +203,102 @@ func main() {
 	thread2 := *threads_num2_
 	input := *Input_
 	output := *Output_
+	path := *Path_
+
+	if (action == "AddNoise" || action == "Simulate") && *Noise_ != "uniform" && *Noise_ != "bernoulli" && *Noise_ != "kmer" {
+		fail("Invalid noise! noise should be uniform, bernoulli or kmer")
+	}
+	model := tools.ErrorModel{Burst: *Burst_, Homopolymer: *Homopolymer_, Ends: *Ends_}
+	if err := model.Validate(); err != nil {
+		fail(err)
+	}
+	if action == "AddNoise" && *Noise_ == "uniform" && !model.Plain() {
+		fail("Invalid noise! burst, homopolymer and ends need -noise bernoulli or kmer")
+	}
+	noise := tools.Noise{Seed: *Seed_, Threads: thread1, Bernoulli: *Noise_ == "bernoulli", Model: model}
 
-	if action == "Encode" {
-		tools.EncodeFile(input, output, params, maxseq)
+	var err error
+	if action == "Encode" && (*Fountain_ || *Extend_) {
+		err = tools.EncodeFountain(input, output, params, primers, maxseq, *Extend_)
+	} else if action == "Encode" {
+		err = tools.EncodeFile(input, output, params, outer, primers, maxseq)
+	} else if action == "AddNoise" && *Noise_ == "kmer" {
+		err = tools.AddKmerNoise(output, *Scale_, *Coverage_, *Flip_, noise)
+	} else if action == "AddNoise" && *Coverage_ > 0 {
+		err = tools.AddNoiseWithCoverage(output, del, ins, rate, *Coverage_, *Flip_, noise)
 	} else if action == "AddNoise" {
-		tools.AddNoise(output, del, ins, err)
+		err = tools.AddNoise(output, del, ins, rate, *Flip_, noise)
+	} else if action == "Trim" {
+		err = tools.TrimFile(input, output)
+	} else if action == "Cluster" {
+		err = tools.ClusterFile(input, output)
+	} else if action == "Decode" && *Joint_ {
+		err = tools.DecodeJoint(output, thread1, params)
 	} else if action == "Decode" {
 		if *DecodeOption_ {
-			tools.DecodeWithEDmax(output, thread1, thread2, params)
+			err = tools.DecodeWithEDmax(output, thread1, thread2, params)
 		} else {
-			tools.DecodeWithFixEDmax(output, thread1, thread2, edmax, params)
+			err = tools.DecodeWithFixEDmax(output, thread1, thread2, edmax, params)
 		}
 	} else if action == "Reconstruction" {
-		tools.ReconstructFile(output, params)
+		err = tools.ReconstructFile(output, params)
+	} else if action == "Retrieve" {
+		err = tools.RetrieveFile(output, path, thread1, params)
+	} else if action == "Mix" {
+		err = tools.MixPool(input, output)
+	} else if action == "Route" {
+		err = tools.RoutePool(input, output, path)
+	} else if action == "Simulate" {
+		c := tools.DefaultChannel()
+		c.SynthSub, c.SynthIns, c.SynthDel = *Synth_/4, *Synth_/4, *Synth_/2
+		c.Truncation = *Truncate_
+		c.Dropout = *Dropout_
+		c.PCRCycles = *PCR_
+		c.PCRSpread = *PCRSpread_
+		if *Coverage_ > 0 {
+			c.Depth = *Coverage_
+		}
+		c.Coverage = *Dist_
+		c.Sub, c.Ins, c.Del = sub, ins, del
+		if *Noise_ == "kmer" {
+			c.Profile, _ = tools.CurrentProfile()
+			c.Scale = *Scale_
+		}
+		c.Model = model
+		c.Chimera = *Chimera_
+		c.Flip = *Flip_
+		c.Seed = *Seed_
+		err = tools.SimulateFile(output, c)
+	} else if action == "Benchmark" {
+		b := tools.Benchmark{Options: splitList(*Options_, option), Noise: noise, Scoring: scoring, MinConfidence: *Confidence_, Threads: thread1, ThreadsPerRead: thread2}
+		if !*DecodeOption_ {
+			b.EDmax = edmax
+		}
+		if *Noise_ == "kmer" {
+			b.Profile, _ = tools.CurrentProfile()
+		}
+		densities, derr := parseFloats(splitList(*Densities_, strconv.FormatFloat(density, 'g', -1, 64)))
+		rates, rerr := parseFloats(splitList(*Errors_, strconv.FormatFloat(rate, 'g', -1, 64)))
+		lengths, lerr := parseInts(splitList(*Lengths_, strconv.Itoa(seqlen)))
+		seeds, serr := parseInts(splitList(*Seeds_, strconv.FormatInt(*Seed_, 10)))
+		if derr != nil || rerr != nil || lerr != nil || serr != nil {
+			fail("Invalid benchmark lists! densities and errors take numbers, lengths and seeds integers")
+		}
+		b.Densities, b.ErrorRates, b.Seeds = densities, rates, seeds
+		for _, l := range lengths {
+			b.Lengths = append(b.Lengths, int(l))
+		}
+		b.Log = os.Stdout
+		err = tools.BenchmarkFile(input, output, b)
+	} else if action == "Profile" {
+		if path == "" {
+			path = output + "/profile"
+		}
+		err = tools.BuildProfile(input, output, path)
 	} else {
-		fmt.Println("Invalid action!")
+		fail("Invalid action!")
+	}
+	if err != nil {
+		fail(err)
 	}
 }
@@ -0,0 +1,386 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// An archive holds every file of a directory in one pool. Each file starts at
+// a new block, and the index, listing the block range of every file, takes the
+// last data blocks; the manifest records its length.
+type ArchiveEntry struct {
+	Path       string
+	Size       int
+	Mode       fs.FileMode
+	StartBlock int
+	BlockNum   int
+	Digest     []byte
+}
+
+const ArchiveMagic = "GI"
+
+func BlockNum(bytesLen int, payloadLen int) int {
+	return (bytesLen*8 + payloadLen - 1) / payloadLen
+}
+
+func ArchiveIndexBytes(entries []ArchiveEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(ArchiveMagic)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(entries)))
+	for _, e := range entries {
+		binary.Write(&buf, binary.LittleEndian, uint16(len(e.Path)))
+		buf.WriteString(e.Path)
+		binary.Write(&buf, binary.LittleEndian, uint64(e.Size))
+		binary.Write(&buf, binary.LittleEndian, uint32(e.Mode))
+		binary.Write(&buf, binary.LittleEndian, uint32(e.StartBlock))
+		binary.Write(&buf, binary.LittleEndian, uint32(e.BlockNum))
+		buf.Write(e.Digest)
+	}
+	return buf.Bytes()
+}
+
+func ParseArchiveIndex(b []byte) ([]ArchiveEntry, bool) {
+	if len(b) < 6 || string(b[0:2]) != ArchiveMagic {
+		return nil, false
+	}
+	count := int(binary.LittleEndian.Uint32(b[2:6]))
+	entries := make([]ArchiveEntry, 0)
+	pos := 6
+	for i := 0; i < count; i++ {
+		if pos+2 > len(b) {
+			return nil, false
+		}
+		pathlen := int(binary.LittleEndian.Uint16(b[pos : pos+2]))
+		pos += 2
+		if pos+pathlen+20+ManifestDigestBytes > len(b) {
+			return nil, false
+		}
+		var e ArchiveEntry
+		e.Path = string(b[pos : pos+pathlen])
+		pos += pathlen
+		e.Size = int(binary.LittleEndian.Uint64(b[pos : pos+8]))
+		e.Mode = fs.FileMode(binary.LittleEndian.Uint32(b[pos+8 : pos+12]))
+		e.StartBlock = int(binary.LittleEndian.Uint32(b[pos+12 : pos+16]))
+		e.BlockNum = int(binary.LittleEndian.Uint32(b[pos+16 : pos+20]))
+		pos += 20
+		e.Digest = make([]byte, ManifestDigestBytes)
+		copy(e.Digest, b[pos:pos+ManifestDigestBytes])
+		pos += ManifestDigestBytes
+		if !filepath.IsLocal(e.Path) {
+			return nil, false
+		}
+		entries = append(entries, e)
+	}
+	return entries, true
+}
+
+func FindEntry(entries []ArchiveEntry, name string) (ArchiveEntry, bool) {
+	name = path.Clean(filepath.ToSlash(name))
+	for _, e := range entries {
+		if e.Path == name {
+			return e, true
+		}
+	}
+	return ArchiveEntry{}, false
+}
+
+// EncodeArchive encodes every regular file under inputdir, in lexical order.
+func EncodeArchive(inputdir string, outputpath string, params Params, outer OuterCode, primers PrimerPair) error {
+
+	if err := os.MkdirAll(outputpath, 0755); err != nil {
+		return err
+	}
+
+	Origin_Name, _, _ := Genfilename(outputpath)
+
+	out, err := os.Create(Origin_Name)
+	if err != nil {
+		return fmt.Errorf("fail to create output: %w", err)
+	}
+	defer out.Close()
+
+	params = params.WithPrimer(primers.Seed())
+	enc, err := NewStreamEncoder(out, params, outer, -1, runtime.NumCPU())
+	if err != nil {
+		return fmt.Errorf("fail to encode: %w", err)
+	}
+	entries := make([]ArchiveEntry, 0)
+
+	err = filepath.WalkDir(inputdir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(inputdir, name)
+		if err != nil {
+			return err
+		}
+		in, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		var e ArchiveEntry
+		e.Path = filepath.ToSlash(rel)
+		e.Mode = info.Mode().Perm()
+		e.StartBlock = enc.BlockNum()
+
+		h := murmur3.New128()
+		size, err := enc.ReadFrom(io.TeeReader(in, h))
+		if err != nil {
+			return err
+		}
+		if err := enc.Align(); err != nil {
+			return err
+		}
+		e.Size = int(size)
+		e.BlockNum = enc.BlockNum() - e.StartBlock
+		h1, h2 := h.Sum128()
+		e.Digest = DigestBytes(h1, h2)
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fail to encode: %w", err)
+	}
+
+	if err := enc.WriteIndex(ArchiveIndexBytes(entries)); err != nil {
+		return fmt.Errorf("fail to encode: %w", err)
+	}
+	manifest, err := enc.Close()
+	if err != nil {
+		return fmt.Errorf("fail to encode: %w", err)
+	}
+
+	if err := WriteSynthesis(outputpath, primers); err != nil {
+		return err
+	}
+
+	fmt.Println("Files: ", len(entries), " Strand Num: ", manifest.StrandNum)
+	return nil
+}
+
+// EntryBytes reads a file back from the data blocks in file order.
+func EntryBytes(blocks []Block, e ArchiveEntry, manifest Manifest, params Params) []byte {
+	content := BlocksintoData(blocks[e.StartBlock:e.StartBlock+e.BlockNum], manifest.BlockBits(), params).Bytes()
+	return content[:e.Size]
+}
+
+func IndexFromBlocks(blocks []Block, manifest Manifest, params Params) ([]ArchiveEntry, bool) {
+	content := BlocksintoData(blocks, manifest.BlockBits(), params).Bytes()
+	if len(content) < manifest.IndexLen {
+		return nil, false
+	}
+	return ParseArchiveIndex(content[:manifest.IndexLen])
+}
+
+// WriteEntry writes a file of the archive under outputdir, with PartialSuffix
+// and ErrDigestMismatch when it fails the digest check.
+func WriteEntry(outputdir string, e ArchiveEntry, content []byte) error {
+	name := filepath.Join(outputdir, filepath.FromSlash(e.Path))
+	mismatch := !bytes.Equal(FileDigest(content), e.Digest)
+	if mismatch {
+		name += PartialSuffix
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, content, e.Mode); err != nil {
+		return fmt.Errorf("fail to write %s: %w", e.Path, err)
+	}
+	if mismatch {
+		return fmt.Errorf("%w: %s, written to %s", ErrDigestMismatch, e.Path, name)
+	}
+	return nil
+}
+
+// RestoreArchive writes every file of the archive under outputdir; blocks are
+// the data blocks in file order.
+func RestoreArchive(blocks []Block, manifest Manifest, params Params, outputdir string) error {
+	entries, ok := IndexFromBlocks(blocks[manifest.IndexStart():], manifest, params)
+	if !ok {
+		return ErrArchiveIndex
+	}
+	mismatch := 0
+	for _, e := range entries {
+		if e.StartBlock+e.BlockNum > manifest.IndexStart() {
+			fmt.Println("Invalid archive entry:", e.Path)
+			continue
+		}
+		err := WriteEntry(outputdir, e, EntryBytes(blocks, e, manifest, params))
+		if errors.Is(err, ErrDigestMismatch) {
+			fmt.Println(err)
+			mismatch++
+		} else if err != nil {
+			return err
+		}
+	}
+	if mismatch > 0 {
+		return fmt.Errorf("%w in %d of %d files", ErrDigestMismatch, mismatch, len(entries))
+	}
+	return nil
+}
+
+// RetrieveFile decodes only the index blocks and the blocks of one file from
+// the noisy reads, and writes the file under filepath/output.
+func RetrieveFile(filepath string, name string, threads_num int, params Params) error {
+	_, Error_Name, _ := Genfilename(filepath)
+	reads, err := LoadReads(Error_Name)
+	if err == nil {
+		err = CheckReads(reads)
+	}
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", Error_Name, err)
+	}
+	reads, clipped := ClipReads(reads)
+	if n := CountTrue(clipped); n > 0 {
+		fmt.Println("Reads longer than", MaxReadLen, "bases clipped:", n)
+	}
+	seqs := Seqs(reads)
+	primer := ReadPrimers(filepath).Seed()
+
+	manifest, used, err := DecodeManifest(seqs, primer, params.FlankLen, threads_num)
+	if err != nil {
+		return fmt.Errorf("fail to retrieve %s: %w", name, err)
+	}
+	if !manifest.IsArchive() {
+		return ErrNotArchive
+	}
+	mparams, err := manifest.Params()
+	if err == nil {
+		params = mparams.WithPrimer(primer).WithFlank(params.FlankLen).WithScoring(params.Scoring).WithConfidence(params.MinConfidence)
+		err = CheckProfile(params)
+	}
+	if err != nil {
+		return fmt.Errorf("fail to retrieve %s: %w", name, err)
+	}
+
+	indexes := make([]int, 0)
+	for i := manifest.IndexStart(); i < manifest.DataNum(); i++ {
+		indexes = append(indexes, i)
+	}
+	indexblocks, found := SearchData(seqs, used, indexes, threads_num, true, manifest, params)
+	if found < len(indexes) {
+		return fmt.Errorf("index not found, index strands recovered: %d / %d", found, len(indexes))
+	}
+	entries, ok := IndexFromBlocks(indexblocks, manifest, params)
+	if !ok {
+		return ErrArchiveIndex
+	}
+
+	e, ok := FindEntry(entries, name)
+	if !ok {
+		return fmt.Errorf("file not in archive: %s", name)
+	}
+
+	indexes = make([]int, e.BlockNum)
+	for i := 0; i < e.BlockNum; i++ {
+		indexes[i] = e.StartBlock + i
+	}
+	fileblocks, found := SearchData(seqs, used, indexes, threads_num, false, manifest, params)
+	fmt.Println("File:", e.Path, " Size:", e.Size, " Strands recovered:", found, "/", e.BlockNum)
+
+	e.StartBlock = 0
+	return WriteEntry(filepath+"/output", e, EntryBytes(fileblocks, e, manifest, params))
+}
+
+// SearchData searches the reads for the data blocks at indexes, counted in
+// file order, and returns them in the same order. When some are missing and
+// the pool has an outer code, the rest of their groups is searched as well and
+// the lost blocks are rebuilt from parity.
+func SearchData(seqs []string, used []bool, indexes []int, threads_num int, fromtail bool, manifest Manifest, params Params) ([]Block, int) {
+	oc := manifest.Outer
+	ids := make([]int, len(indexes))
+	for i := 0; i < len(indexes); i++ {
+		ids[i] = oc.BlockID(indexes[i])
+	}
+	blocks, found := SearchBlocks(seqs, used, ids, threads_num, fromtail, false, nil, params)
+	if found == len(ids) || !oc.Enabled() {
+		return blocks, found
+	}
+
+	pool := make([]Block, manifest.StrandNum)
+	for i := 0; i < len(blocks); i++ {
+		if len(blocks[i].Payload) > 0 {
+			pool[ids[i]] = blocks[i]
+		}
+	}
+	groupLen := oc.DataNum + oc.ParityNum
+	tried := make(map[int]bool)
+	for _, id := range ids {
+		tried[id] = true
+	}
+	searched := make(map[int]bool)
+	rest := make([]int, 0)
+	for i := 0; i < len(blocks); i++ {
+		g := ids[i] / groupLen
+		if len(blocks[i].Payload) > 0 || searched[g] {
+			continue
+		}
+		searched[g] = true
+		for id := g * groupLen; id < (g+1)*groupLen && id < len(pool); id++ {
+			if !tried[id] {
+				rest = append(rest, id)
+			}
+		}
+	}
+	restblocks, _ := SearchBlocks(seqs, used, rest, threads_num, fromtail, false, nil, params)
+	for k := 0; k < len(rest); k++ {
+		if len(restblocks[k].Payload) > 0 {
+			pool[rest[k]] = restblocks[k]
+		}
+	}
+
+	data, recovered := oc.Recover(pool, params)
+	fmt.Println("Strands recovered by parity:", recovered)
+	found = 0
+	for i := 0; i < len(indexes); i++ {
+		blocks[i] = data[indexes[i]]
+		if len(blocks[i].Payload) > 0 {
+			found++
+		}
+	}
+	return blocks, found
+}
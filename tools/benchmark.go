@@ -0,0 +1,264 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// BenchmarkCSV and BenchmarkJSON hold the results under the output path.
+const BenchmarkCSV = "/benchmark.csv"
+const BenchmarkJSON = "/benchmark.json"
+
+// BenchmarkCase is one configuration of a sweep.
+type BenchmarkCase struct {
+	Option    string  `json:"option"`
+	Density   float64 `json:"density"`
+	Length    int     `json:"length"`
+	ErrorRate float64 `json:"error_rate"`
+	Seed      int64   `json:"seed"`
+}
+
+// BenchmarkResult is what came of a case. Recovery is the share of strands
+// decoded right, as the Decode action prints it, and Recovered whether the
+// file came back byte for byte. Hypotheses is the peak frontier of any read,
+// the most distinct hypotheses a search held at one depth, HypothesisCap the
+// most a round allowed, and Seconds covers encoding, noise, decoding and
+// reconstruction.
+type BenchmarkResult struct {
+	BenchmarkCase
+	Strands       int     `json:"strands"`
+	Failures      int     `json:"failures"`
+	Mistakes      int     `json:"mistakes"`
+	Recovery      float64 `json:"recovery"`
+	Precision     float64 `json:"precision"`
+	Recall        float64 `json:"recall"`
+	Recovered     bool    `json:"recovered"`
+	Seconds       float64 `json:"seconds"`
+	Hypotheses    int     `json:"hypotheses"`
+	HypothesisCap int     `json:"hypothesis_cap"`
+	EDmax         int     `json:"edmax"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Benchmark sweeps every combination of its lists over one file, in
+// process. Each error rate is split evenly into substitutions, insertions
+// and deletions and drawn with Noise, whose seed each case sets; with
+// Profile, errors follow the profile scaled to the rate instead. Scoring,
+// MinConfidence, Threads, ThreadsPerRead and EDmax go to the Codec of every
+// case.
+type Benchmark struct {
+	Options    []string
+	Densities  []float64
+	Lengths    []int
+	ErrorRates []float64
+	Seeds      []int64
+
+	Noise          Noise
+	Profile        *ErrorProfile
+	Scoring        *KmerCost
+	MinConfidence  float64
+	Threads        int
+	ThreadsPerRead int
+	EDmax          int
+	Log            io.Writer
+}
+
+func (b Benchmark) Cases() []BenchmarkCase {
+	res := make([]BenchmarkCase, 0)
+	for _, option := range b.Options {
+		for _, density := range b.Densities {
+			for _, length := range b.Lengths {
+				for _, rate := range b.ErrorRates {
+					for _, seed := range b.Seeds {
+						res = append(res, BenchmarkCase{Option: option, Density: density, Length: length, ErrorRate: rate, Seed: seed})
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// Run goes through the cases in order; a case that cannot run records its
+// error and the sweep goes on.
+func (b Benchmark) Run(content []byte) []BenchmarkResult {
+	cases := b.Cases()
+	res := make([]BenchmarkResult, 0, len(cases))
+	for i, bc := range cases {
+		r := b.RunCase(content, bc)
+		if b.Log != nil {
+			if r.Error != "" {
+				fmt.Fprintf(b.Log, "[%d/%d] %s density %.2f length %d error %.3f seed %d: %s\n",
+					i+1, len(cases), bc.Option, bc.Density, bc.Length, bc.ErrorRate, bc.Seed, r.Error)
+			} else {
+				fmt.Fprintf(b.Log, "[%d/%d] %s density %.2f length %d error %.3f seed %d: recovery %.4f, recovered %t, %.1fs\n",
+					i+1, len(cases), bc.Option, bc.Density, bc.Length, bc.ErrorRate, bc.Seed, r.Recovery, r.Recovered, r.Seconds)
+			}
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+func (b Benchmark) RunCase(content []byte, bc BenchmarkCase) (res BenchmarkResult) {
+	res.BenchmarkCase = bc
+	start := time.Now()
+	defer func() {
+		res.Seconds = time.Since(start).Seconds()
+	}()
+
+	params, err := SizeParams(bc.Option, bc.Density, bc.Length)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	c := NewCodec(params.WithScoring(b.Scoring).WithConfidence(b.MinConfidence))
+	c.Threads = max(1, b.Threads)
+	c.ThreadsPerRead = max(1, b.ThreadsPerRead)
+	c.EDmax = b.EDmax
+	strands, _, err := c.EncodeBytes(content)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	n := b.Noise
+	n.Seed = bc.Seed
+	rate := bc.ErrorRate / 3
+	var seqs []string
+	if b.Profile != nil {
+		seqs = n.AddKmerError(strands, b.Profile, bc.ErrorRate*KmerSize/b.Profile.ErrorRate)
+	} else if n.Bernoulli {
+		seqs = n.AddBernoulliError(strands, rate, rate, rate)
+	} else {
+		seqs = n.AddError(strands, rate, rate, rate, bc.ErrorRate)
+	}
+	reads := make([]Read, len(seqs))
+	for i := range seqs {
+		reads[i] = Read{Seq: seqs[i]}
+	}
+
+	d, err := c.DecodeReads(reads)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	origin, _, _, _ := SplitPool(strands, d.Params.Primer, c.Threads)
+	decoded, err := d.Strands()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Strands = len(d.Blocks)
+	for i := range d.Blocks {
+		if len(d.Blocks[i].Payload) == 0 {
+			res.Failures++
+		} else if i >= len(origin) || decoded[i] != origin[i] {
+			res.Mistakes++
+		}
+	}
+	res.Recovery = 1 - float64(res.Failures+res.Mistakes)/float64(res.Strands)
+	if res.Strands > res.Failures {
+		res.Precision = float64(res.Strands-res.Failures-res.Mistakes) / float64(res.Strands-res.Failures)
+	}
+	res.Recall = float64(res.Strands-res.Failures) / float64(res.Strands)
+	for _, r := range d.Reports {
+		res.Hypotheses = max(res.Hypotheses, r.Peak)
+	}
+	res.HypothesisCap = d.Hmax
+	res.EDmax = d.EDmax
+
+	out, err := c.Reconstruct(decoded)
+	res.Recovered = err == nil && bytes.Equal(out, content)
+	return res
+}
+
+func WriteBenchmarkCSV(results []BenchmarkResult, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"option", "density", "length", "error_rate", "seed", "strands", "failures", "mistakes",
+		"recovery", "precision", "recall", "recovered", "seconds", "hypotheses", "hypothesis_cap", "edmax", "error"})
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	for _, r := range results {
+		cw.Write([]string{r.Option, f(r.Density), strconv.Itoa(r.Length), f(r.ErrorRate), strconv.FormatInt(r.Seed, 10),
+			strconv.Itoa(r.Strands), strconv.Itoa(r.Failures), strconv.Itoa(r.Mistakes),
+			f(r.Recovery), f(r.Precision), f(r.Recall), strconv.FormatBool(r.Recovered),
+			strconv.FormatFloat(r.Seconds, 'f', 3, 64), strconv.Itoa(r.Hypotheses), strconv.Itoa(r.HypothesisCap),
+			strconv.Itoa(r.EDmax), r.Error})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// BenchmarkFile runs the sweep over inputfile and writes the results to
+// BenchmarkCSV and BenchmarkJSON under outputpath.
+func BenchmarkFile(inputfile string, outputpath string, b Benchmark) error {
+	content, err := os.ReadFile(inputfile)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", inputfile, err)
+	}
+	if len(b.Cases()) == 0 {
+		return errors.New("no benchmark cases")
+	}
+	if err := os.MkdirAll(outputpath, 0755); err != nil {
+		return err
+	}
+	results := b.Run(content)
+
+	var buf bytes.Buffer
+	err = WriteBenchmarkCSV(results, &buf)
+	if err == nil {
+		err = os.WriteFile(outputpath+BenchmarkCSV, buf.Bytes(), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("fail to write %s: %w", outputpath+BenchmarkCSV, err)
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err == nil {
+		err = os.WriteFile(outputpath+BenchmarkJSON, data, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("fail to write %s: %w", outputpath+BenchmarkJSON, err)
+	}
+	recovered := 0
+	for _, r := range results {
+		if r.Recovered {
+			recovered++
+		}
+	}
+	fmt.Println("Cases:", len(results), " Recovered:", recovered, " Results in", outputpath+BenchmarkCSV, "and", outputpath+BenchmarkJSON)
+	return nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import "encoding/binary"
+
+// Bitset packs bits LSB-first into 64-bit words, in the same order as
+// Bytes2Bits, so its little-endian bytes equal Bits2Bytes of the same bits.
+type Bitset struct {
+	Words  []uint64
+	Length int
+}
+
+func NewBitset(n int) Bitset {
+	return Bitset{Words: make([]uint64, (n+63)/64), Length: n}
+}
+
+func BitsetFromBytes(b []byte) Bitset {
+	bs := NewBitset(8 * len(b))
+	for i := 0; i < len(b); i++ {
+		bs.Words[i/8] |= uint64(b[i]) << (8 * (i & 7))
+	}
+	return bs
+}
+
+func BitsetFromInts(bits []int) Bitset {
+	bs := NewBitset(len(bits))
+	for i := 0; i < len(bits); i++ {
+		bs.Set(i, bits[i])
+	}
+	return bs
+}
+
+// BitsetFromUint takes the n lowest bits of val, n <= 64.
+func BitsetFromUint(val uint64, n int) Bitset {
+	bs := NewBitset(n)
+	if n > 0 {
+		if n < 64 {
+			val &= (1 << n) - 1
+		}
+		bs.Words[0] = val
+	}
+	return bs
+}
+
+// BitsetFromWords copies bits [start, end) out of 64-bit packed words.
+func BitsetFromWords(words []int, start, end int) Bitset {
+	bs := NewBitset(end - start)
+	for i := 0; i < len(bs.Words); i++ {
+		n := 64
+		if end-start-64*i < 64 {
+			n = end - start - 64*i
+		}
+		bs.Words[i] = uint64(BitsetWordsUint(words, start+64*i, n))
+	}
+	return bs
+}
+
+// BitsetWordsUint reads n <= 64 bits from start out of 64-bit packed words.
+func BitsetWordsUint(words []int, start, n int) uint64 {
+	if n == 0 {
+		return 0
+	}
+	w := start / 64
+	off := uint(start & 63)
+	val := uint64(words[w]) >> off
+	if off > 0 && int(off)+n > 64 {
+		val |= uint64(words[w+1]) << (64 - off)
+	}
+	if n < 64 {
+		val &= (1 << n) - 1
+	}
+	return val
+}
+
+func (bs Bitset) Len() int {
+	return bs.Length
+}
+
+func (bs Bitset) Get(i int) int {
+	return int((bs.Words[i/64] >> (i & 63)) & 1)
+}
+
+func (bs *Bitset) Set(i int, bit int) {
+	if bit&1 == 1 {
+		bs.Words[i/64] |= 1 << (i & 63)
+	} else {
+		bs.Words[i/64] &^= 1 << (i & 63)
+	}
+}
+
+// Uint returns bits [start, end) as an integer, end - start <= 64.
+func (bs Bitset) Uint(start, end int) uint64 {
+	return bs.uint(start, end-start)
+}
+
+func (bs Bitset) Slice(start, end int) Bitset {
+	res := NewBitset(end - start)
+	for i := 0; i < len(res.Words); i++ {
+		n := 64
+		if end-start-64*i < 64 {
+			n = end - start - 64*i
+		}
+		res.Words[i] = bs.uint(start+64*i, n)
+	}
+	return res
+}
+
+func (bs Bitset) uint(start, n int) uint64 {
+	if n == 0 {
+		return 0
+	}
+	w := start / 64
+	off := uint(start & 63)
+	val := bs.Words[w] >> off
+	if off > 0 && int(off)+n > 64 {
+		val |= bs.Words[w+1] << (64 - off)
+	}
+	if n < 64 {
+		val &= (1 << n) - 1
+	}
+	return val
+}
+
+func (bs *Bitset) Append(o Bitset) {
+	start := bs.Length
+	bs.Length += o.Length
+	for len(bs.Words) < (bs.Length+63)/64 {
+		bs.Words = append(bs.Words, 0)
+	}
+	for i := 0; i < len(o.Words); i++ {
+		n := 64
+		if o.Length-64*i < 64 {
+			n = o.Length - 64*i
+		}
+		bs.writeUint(start+64*i, n, o.Words[i])
+	}
+}
+
+// Grow pads the set with zero bits up to n bits.
+func (bs *Bitset) Grow(n int) {
+	if n <= bs.Length {
+		return
+	}
+	bs.Length = n
+	for len(bs.Words) < (n+63)/64 {
+		bs.Words = append(bs.Words, 0)
+	}
+}
+
+func (bs *Bitset) writeUint(start, n int, val uint64) {
+	if n == 0 {
+		return
+	}
+	w := start / 64
+	off := uint(start & 63)
+	bs.Words[w] |= val << off
+	if off > 0 && int(off)+n > 64 {
+		bs.Words[w+1] |= val >> (64 - off)
+	}
+}
+
+// Bytes matches Bits2Bytes, which gives one zero byte for an empty input.
+func (bs Bitset) Bytes() []byte {
+	bytesLen := (bs.Length-1)/8 + 1
+	buf := make([]byte, 8*len(bs.Words))
+	for i := 0; i < len(bs.Words); i++ {
+		binary.LittleEndian.PutUint64(buf[8*i:], bs.Words[i])
+	}
+	if bytesLen > len(buf) {
+		return make([]byte, bytesLen)
+	}
+	return buf[:bytesLen]
+}
+
+// Xor assumes o is no longer than bs.
+func (bs *Bitset) Xor(o Bitset) {
+	for i := 0; i < len(o.Words); i++ {
+		bs.Words[i] ^= o.Words[i]
+	}
+}
+
+func (bs Bitset) Ints() []int {
+	res := make([]int, bs.Length)
+	for i := 0; i < bs.Length; i++ {
+		res[i] = bs.Get(i)
+	}
+	return res
+}
+
+func (bs Bitset) Equal(o Bitset) bool {
+	if bs.Length != o.Length {
+		return false
+	}
+	for i := 0; i < len(bs.Words); i++ {
+		if bs.Words[i] != o.Words[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,271 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// ProfilePrior is the weight, in bases, of the prior that Counts mixes into
+// every k-mer; the prior is the rate of the k-mers that share the base and
+// its neighbours. Written counts are scaled by ProfileScale so the prior
+// stays a whole number of errors.
+const ProfilePrior = 20
+const ProfileScale = 100
+
+// ProfileBuilder tallies, for every position in the k-mer, how often the
+// base there was substituted, deleted or followed by an insertion in reads
+// aligned to their reference.
+type ProfileBuilder struct {
+	counts [KmerSize][]Kmer_json
+	Reads  int
+	Bases  int
+}
+
+func NewProfileBuilder() *ProfileBuilder {
+	b := &ProfileBuilder{}
+	for i := range b.counts {
+		b.counts[i] = make([]Kmer_json, KmerMask+1)
+	}
+	return b
+}
+
+// Add aligns read to ref with EditScript and tallies its edits. Bases
+// inserted before the first reference base count for that base.
+func (b *ProfileBuilder) Add(ref string, read string) {
+	_, ops := EditScript(ref, read)
+	X := make([]int, len(ref))
+	I := make([]int, len(ref))
+	D := make([]int, len(ref))
+	p := 0
+	for _, op := range ops {
+		switch op {
+		case EditSub:
+			X[p]++
+			p++
+		case EditDel:
+			D[p]++
+			p++
+		case EditIns:
+			if len(ref) > 0 {
+				I[max(p-1, 0)]++
+			}
+		default:
+			p++
+		}
+	}
+
+	for p := range ref {
+		for i := 0; i < KmerSize; i++ {
+			start := p - i
+			if start < 0 || start+KmerSize > len(ref) {
+				continue
+			}
+			kmer := ref[start : start+KmerSize]
+			if CheckBases("", kmer) != nil {
+				continue
+			}
+			c := &b.counts[i][KmerIndex(kmer)]
+			c.X += X[p]
+			c.I += I[p]
+			c.D += D[p]
+			c.Total++
+		}
+	}
+	b.Reads++
+	b.Bases += len(ref)
+}
+
+// Counts gives the smoothed tables, one per position in the k-mer, in the
+// format of the Kmer_json files.
+func (b *ProfileBuilder) Counts() ([]map[string]Kmer_json, error) {
+	res := make([]map[string]Kmer_json, KmerSize)
+	for i := 0; i < KmerSize; i++ {
+		lo, hi := max(i-1, 0), min(i+2, KmerSize)
+		pool := make(map[string]Kmer_json)
+		var all Kmer_json
+		for index, c := range b.counts[i] {
+			key := KmerString(index)[lo:hi]
+			temp := pool[key]
+			temp.X += c.X
+			temp.I += c.I
+			temp.D += c.D
+			temp.Total += c.Total
+			pool[key] = temp
+			all.X += c.X
+			all.I += c.I
+			all.D += c.D
+			all.Total += c.Total
+		}
+		if all.Total == 0 {
+			return nil, fmt.Errorf("no aligned %d-mer covers position %d", KmerSize, i)
+		}
+
+		res[i] = make(map[string]Kmer_json, KmerMask+1)
+		for index, c := range b.counts[i] {
+			kmer := KmerString(index)
+			prior := pool[kmer[lo:hi]]
+			if prior.Total == 0 {
+				prior = all
+			}
+			weight := float64(ProfilePrior*ProfileScale) / float64(prior.Total)
+			res[i][kmer] = Kmer_json{
+				X:     c.X*ProfileScale + int(float64(prior.X)*weight+0.5),
+				I:     c.I*ProfileScale + int(float64(prior.I)*weight+0.5),
+				D:     c.D*ProfileScale + int(float64(prior.D)*weight+0.5),
+				Total: (c.Total + ProfilePrior) * ProfileScale,
+			}
+		}
+	}
+	return res, nil
+}
+
+// Write saves the tables as dir/<name>_7_<position>.json, the layout
+// LoadProfile reads.
+func (b *ProfileBuilder) Write(dir string, name string) error {
+	counts, err := b.Counts()
+	if err != nil {
+		return err
+	}
+	if _, err := NewErrorProfile(dir, counts); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i, table := range counts {
+		data, err := json.Marshal(table)
+		if err != nil {
+			return err
+		}
+		file := filepath.Join(dir, name+"_"+strconv.Itoa(KmerSize)+"_"+strconv.Itoa(i)+".json")
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PairReads finds the reference of every read among refs: the candidate
+// sharing MinHash bands with the fewest edits, within ClusterMaxErrorRate.
+// A read that only matches as its reverse complement is flipped in place.
+// Unpaired reads get -1; the number paired is returned too.
+func PairReads(refs []string, reads []string) ([]int, int) {
+	buckets := make(map[bandKey][]int)
+	for r, ref := range refs {
+		for _, key := range bandKeys(MinHash(ref)) {
+			buckets[key] = append(buckets[key], r)
+		}
+	}
+	find := func(read string) int {
+		votes := make(map[int]int)
+		for _, key := range bandKeys(MinHash(read)) {
+			for _, r := range buckets[key] {
+				votes[r]++
+			}
+		}
+		candidates := make([]int, 0, len(votes))
+		for r := range votes {
+			candidates = append(candidates, r)
+		}
+		sort.Slice(candidates, func(a, b int) bool {
+			if votes[candidates[a]] != votes[candidates[b]] {
+				return votes[candidates[a]] > votes[candidates[b]]
+			}
+			return candidates[a] < candidates[b]
+		})
+		best, bestdist := -1, 0
+		for k := 0; k < len(candidates) && k < ClusterMaxCandidates; k++ {
+			ref := refs[candidates[k]]
+			dist, _, _, _ := EditingDistance(ref, read)
+			if float64(dist) <= ClusterMaxErrorRate*float64(len(ref)) && (best < 0 || dist < bestdist) {
+				best, bestdist = candidates[k], dist
+			}
+		}
+		return best
+	}
+
+	pairs := make([]int, len(reads))
+	paired := 0
+	for i, read := range reads {
+		pairs[i] = find(read)
+		if pairs[i] < 0 {
+			rev := GenRevString(read)
+			if r := find(rev); r >= 0 {
+				reads[i] = rev
+				pairs[i] = r
+			}
+		}
+		if pairs[i] >= 0 {
+			paired++
+		}
+	}
+	return pairs, paired
+}
+
+// BuildProfile learns an error profile from the reads in readpath, aligned
+// to the strands in outputpath/Origin, and writes it to profiledir.
+func BuildProfile(readpath string, outputpath string, profiledir string) error {
+	Origin_Name, _, _ := Genfilename(outputpath)
+	refs, err := LoadReads(Origin_Name)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", Origin_Name, err)
+	}
+	records, err := LoadReads(readpath)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", readpath, err)
+	}
+	if len(refs) == 0 || len(records) == 0 {
+		return fmt.Errorf("no strands in %s or no reads in %s", Origin_Name, readpath)
+	}
+
+	refseqs := Seqs(refs)
+	reads := Seqs(records)
+	pairs, paired := PairReads(refseqs, reads)
+	b := NewProfileBuilder()
+	for i, r := range pairs {
+		if r >= 0 {
+			b.Add(refseqs[r], reads[i])
+		}
+	}
+
+	name := filepath.Base(filepath.Clean(profiledir))
+	if err := b.Write(profiledir, name); err != nil {
+		return fmt.Errorf("fail to build profile: %w", err)
+	}
+	p, err := LoadProfile(profiledir)
+	if err != nil {
+		return fmt.Errorf("fail to load profile: %w", err)
+	}
+	fmt.Println("Reads:", len(reads), " Paired:", paired, " Bases:", b.Bases)
+	fmt.Printf("Profile written to %s, error rate %.4f\n", profiledir, p.ErrorRate/float64(KmerSize))
+	return nil
+}
@@ -0,0 +1,328 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+// SimulatedFile holds the reads of Simulate under the output path.
+const SimulatedFile = "/Reads.fastq"
+
+const (
+	CoveragePoisson = "poisson"
+	CoverageGamma   = "gamma"
+)
+
+// Channel is the way of a pool from synthesis to sequencing. Rates are per
+// base unless said otherwise.
+type Channel struct {
+	// Synthesis makes Molecules copies of every strand, each with its own
+	// errors; a share Truncation of them stops early and keeps only the end
+	// of the strand, as synthesis runs from the 3' end.
+	Molecules  int
+	SynthSub   float64
+	SynthIns   float64
+	SynthDel   float64
+	Truncation float64
+
+	// Dropout is the share of strands lost before sequencing.
+	Dropout float64
+
+	// Each molecule copies itself in every PCR cycle with its own efficiency,
+	// drawn around PCREfficiency with deviation PCRSpread, so copy numbers
+	// skew over the cycles.
+	PCRCycles     int
+	PCREfficiency float64
+	PCRSpread     float64
+
+	// Depth is the mean number of reads per strand that was not lost. With
+	// CoverageGamma the mean of each strand also varies as a gamma
+	// distribution of shape Dispersion, for more strands with few reads.
+	Depth      float64
+	Coverage   string
+	Dispersion float64
+
+	// Reads get errors at Sub, Ins and Del, or at the rates of Profile times
+	// Scale when set, shaped by Model. A share Chimera of the reads joins the start of one
+	// read to the end of another, and a share Flip is read from the other
+	// strand.
+	Sub     float64
+	Ins     float64
+	Del     float64
+	Profile *ErrorProfile
+	Scale   float64
+	Model   ErrorModel
+	Chimera float64
+	Flip    float64
+
+	// Seed derives a generator for every strand, see StrandRand.
+	Seed int64
+}
+
+// ChannelStats counts what happened to the pool in Simulate.
+type ChannelStats struct {
+	Strands   int
+	Dropped   int
+	Truncated int
+	Unread    int
+	Reads     int
+	Chimeras  int
+	Flipped   int
+}
+
+// DefaultChannel is a pool with 1% errors in synthesis and sequencing, a
+// little dropout and PCR skew, read 10 times per strand.
+func DefaultChannel() Channel {
+	return Channel{
+		Molecules:     10,
+		SynthSub:      0.001,
+		SynthIns:      0.001,
+		SynthDel:      0.002,
+		Truncation:    0.05,
+		Dropout:       0.01,
+		PCRCycles:     15,
+		PCREfficiency: 0.9,
+		PCRSpread:     0.05,
+		Depth:         10,
+		Coverage:      CoveragePoisson,
+		Dispersion:    4,
+		Sub:           0.01,
+		Ins:           0.01,
+		Del:           0.01,
+		Scale:         1,
+	}
+}
+
+func (c Channel) Validate() error {
+	rates := []float64{c.SynthSub, c.SynthIns, c.SynthDel, c.Truncation, c.Dropout, c.PCREfficiency,
+		c.Sub, c.Ins, c.Del, c.Chimera, c.Flip}
+	for _, r := range rates {
+		if r < 0 || r > 1 || math.IsNaN(r) {
+			return &ParamsError{Msg: "channel rates must be in range [0, 1]"}
+		}
+	}
+	if c.Molecules < 1 {
+		return &ParamsError{Msg: "at least one molecule per strand is needed"}
+	}
+	if c.PCRCycles < 0 || c.PCRSpread < 0 || c.Depth <= 0 || c.Scale < 0 {
+		return &ParamsError{Msg: "PCR cycles, PCR spread and scale must not be negative, depth must be positive"}
+	}
+	if err := c.Model.Validate(); err != nil {
+		return err
+	}
+	if c.Coverage != CoveragePoisson && c.Coverage != CoverageGamma {
+		return &ParamsError{Msg: "coverage must be " + CoveragePoisson + " or " + CoverageGamma}
+	}
+	if c.Coverage == CoverageGamma && c.Dispersion <= 0 {
+		return &ParamsError{Msg: "gamma coverage needs a positive dispersion"}
+	}
+	return nil
+}
+
+type molecule struct {
+	seq    string
+	weight float64
+}
+
+// Simulate sends strands through the channel and gives the reads in random
+// order, with qualities from the error rates of their bases. Read IDs are
+// read_<n>, followed by the strand the read came from.
+func (c Channel) Simulate(strands []string) ([]Read, ChannelStats, error) {
+	stats := ChannelStats{Strands: len(strands)}
+	if err := c.Validate(); err != nil {
+		return nil, stats, err
+	}
+	pools := make([][]molecule, len(strands))
+	weights := make([]float64, len(strands))
+	total, kept := 0.0, 0
+	for i, strand := range strands {
+		r := StrandRand(c.Seed, i)
+		if r.Float64() < c.Dropout {
+			stats.Dropped++
+			continue
+		}
+		kept++
+		synth := UniformRates(len(strand), c.SynthSub, c.SynthIns, c.SynthDel)
+		for m := 0; m < c.Molecules; m++ {
+			seq, _ := MutateBases(strand, synth, 1, r)
+			if len(seq) > 1 && r.Float64() < c.Truncation {
+				seq = seq[1+r.Intn(len(seq)-1):]
+				stats.Truncated++
+			}
+			eff := max(0, min(1, c.PCREfficiency+c.PCRSpread*r.NormFloat64()))
+			w := math.Pow(1+eff, float64(c.PCRCycles))
+			pools[i] = append(pools[i], molecule{seq: seq, weight: w})
+			weights[i] += w
+		}
+		total += weights[i]
+	}
+
+	reads := make([]Read, 0, int(c.Depth*float64(kept))+1)
+	strandOf := make([]int, 0, cap(reads))
+	for i := range strands {
+		if weights[i] == 0 {
+			continue
+		}
+		r := StrandRand(c.Seed, len(strands)+i)
+		mean := c.Depth * float64(kept) * weights[i] / total
+		if c.Coverage == CoverageGamma {
+			mean *= gamma(r, c.Dispersion) / c.Dispersion
+		}
+		n := Poisson(mean, r)
+		if n == 0 {
+			stats.Unread++
+		}
+		for k := 0; k < n; k++ {
+			reads = append(reads, c.read(pickMolecule(r, pools[i], weights[i]), r))
+			strandOf = append(strandOf, i)
+		}
+	}
+
+	r := StrandRand(c.Seed, chimeraStream)
+	res := make([]Read, len(reads))
+	for k := range reads {
+		res[k] = reads[k]
+		if c.Chimera > 0 && len(reads) > 1 && r.Float64() < c.Chimera {
+			other := r.Intn(len(reads) - 1)
+			if other >= k {
+				other++
+			}
+			res[k] = joinReads(reads[k], reads[other], r)
+			res[k].ID = "strand=" + strconv.Itoa(strandOf[k]) + " chimera=" + strconv.Itoa(strandOf[other])
+			stats.Chimeras++
+		} else {
+			res[k].ID = "strand=" + strconv.Itoa(strandOf[k])
+		}
+		if r.Float64() < c.Flip {
+			res[k] = res[k].RevComp()
+			stats.Flipped++
+		}
+	}
+	r.Shuffle(len(res), func(a, b int) {
+		res[a], res[b] = res[b], res[a]
+	})
+	for k := range res {
+		res[k].ID = "read_" + strconv.Itoa(k) + " " + res[k].ID
+	}
+	stats.Reads = len(res)
+	return res, stats, nil
+}
+
+// read sequences one molecule.
+func (c Channel) read(seq string, r *rand.Rand) Read {
+	var rates []Kmer
+	scale := 1.0
+	if c.Profile != nil {
+		rates, scale = BaseRates(seq, c.Profile), c.Scale
+	} else {
+		rates = UniformRates(len(seq), c.Sub, c.Ins, c.Del)
+	}
+	read, probs := c.Model.Mutate(seq, rates, scale, r)
+	qual := make([]int, len(probs))
+	for k, p := range probs {
+		q := 40.0
+		if p > 0 {
+			q = -10 * math.Log10(p)
+		}
+		qual[k] = int(math.Round(max(2, min(40, q+3*r.NormFloat64()))))
+	}
+	return Read{Seq: read, Qual: qual}
+}
+
+func pickMolecule(r *rand.Rand, pool []molecule, total float64) string {
+	u := r.Float64() * total
+	for k := range pool {
+		u -= pool[k].weight
+		if u < 0 {
+			return pool[k].seq
+		}
+	}
+	return pool[len(pool)-1].seq
+}
+
+func joinReads(a Read, b Read, r *rand.Rand) Read {
+	cut1 := r.Intn(len(a.Seq) + 1)
+	cut2 := r.Intn(len(b.Seq) + 1)
+	res := Read{Seq: a.Seq[:cut1] + b.Seq[cut2:]}
+	res.Qual = append(append([]int{}, a.Qual[:cut1]...), b.Qual[cut2:]...)
+	return res
+}
+
+// gamma draws from the gamma distribution of the shape and scale 1, by
+// Marsaglia and Tsang.
+func gamma(r *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		return gamma(r, shape+1) * math.Pow(r.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := r.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := r.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// SimulateFile sends the strands of outputpath through the channel and
+// writes the reads to SimulatedFile. The synthesis-ready strands are used
+// when primers are attached, so the reads go through Trim like real ones.
+func SimulateFile(outputpath string, c Channel) error {
+	Origin_Name, _, _ := Genfilename(outputpath)
+	source := Origin_Name
+	if ReadPrimers(outputpath).Attached() {
+		source = outputpath + SynthesisFile
+	}
+	strands, err := LoadReads(source)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", source, err)
+	}
+	reads, stats, err := c.Simulate(Seqs(strands))
+	if err != nil {
+		return err
+	}
+	if len(reads) == 0 {
+		return errors.New("no reads came through the channel")
+	}
+	Reads_Name := outputpath + SimulatedFile
+	if err := WriteReads(reads, Reads_Name); err != nil {
+		return fmt.Errorf("fail to write %s: %w", Reads_Name, err)
+	}
+	fmt.Println("Strands:", stats.Strands, " Dropped:", stats.Dropped, " Truncated molecules:", stats.Truncated, " Unread:", stats.Unread)
+	fmt.Println("Reads:", stats.Reads, " Chimeras:", stats.Chimeras, " Reverse complemented:", stats.Flipped)
+	return nil
+}
@@ -0,0 +1,449 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Reads of the same strand are grouped before decoding. Every read gets a
+// MinHash signature of its k-mers; reads sharing a band of the signature are
+// candidates, and a read joins the first candidate cluster whose first read is
+// within ClusterMaxErrorRate edits. Each cluster is then reduced to one
+// consensus read by aligning its reads to a reference and voting per column.
+const ClusterKmer = 7
+const ClusterHashes = 32
+const ClusterBandRows = 1
+const ClusterMaxCandidates = 16
+const ClusterMaxErrorRate = 0.25
+const ConsensusRounds = 2
+
+// The reference read is picked among the first reads of a cluster only.
+const ConsensusMedoidReads = 10
+
+type bandKey struct {
+	band   int
+	values [ClusterBandRows]uint64
+}
+
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// MinHash gives the signature of the k-mers of a read; k-mers with bases
+// other than A, C, G and T are skipped.
+func MinHash(read string) []uint64 {
+	sig := make([]uint64, ClusterHashes)
+	for h := range sig {
+		sig[h] = ^uint64(0)
+	}
+	var kmer uint64
+	valid := 0
+	for i := 0; i < len(read); i++ {
+		var c uint64
+		switch read[i] {
+		case 'A':
+			c = 0
+		case 'C':
+			c = 1
+		case 'G':
+			c = 2
+		case 'T':
+			c = 3
+		default:
+			valid = 0
+			continue
+		}
+		kmer = (kmer<<2 | c) & (1<<(2*ClusterKmer) - 1)
+		valid++
+		if valid < ClusterKmer {
+			continue
+		}
+		for h := range sig {
+			v := mix64(kmer ^ mix64(uint64(h)+1))
+			if v < sig[h] {
+				sig[h] = v
+			}
+		}
+	}
+	return sig
+}
+
+func bandKeys(sig []uint64) []bandKey {
+	keys := make([]bandKey, 0, ClusterHashes/ClusterBandRows)
+	for b := 0; b+ClusterBandRows <= len(sig); b += ClusterBandRows {
+		var key bandKey
+		key.band = b / ClusterBandRows
+		copy(key.values[:], sig[b:b+ClusterBandRows])
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// ClusterReads groups reads of the same strand; clusters hold read indices,
+// largest cluster first. A read that only matches a cluster as its reverse
+// complement is flipped in place, so each cluster reads one way; the number
+// of flipped reads is returned.
+func ClusterReads(reads []string) ([][]int, int) {
+	buckets := make(map[bandKey][]int)
+	clusters := make([][]int, 0)
+	find := func(read string) (int, []bandKey) {
+		keys := bandKeys(MinHash(read))
+
+		votes := make(map[int]int)
+		for _, key := range keys {
+			for _, c := range buckets[key] {
+				votes[c]++
+			}
+		}
+		candidates := make([]int, 0, len(votes))
+		for c := range votes {
+			candidates = append(candidates, c)
+		}
+		sort.Slice(candidates, func(a, b int) bool {
+			if votes[candidates[a]] != votes[candidates[b]] {
+				return votes[candidates[a]] > votes[candidates[b]]
+			}
+			return candidates[a] < candidates[b]
+		})
+
+		for k := 0; k < len(candidates) && k < ClusterMaxCandidates; k++ {
+			rep := reads[clusters[candidates[k]][0]]
+			dist, _, _, _ := EditingDistance(rep, read)
+			if float64(dist) <= ClusterMaxErrorRate*float64(len(rep)) {
+				return candidates[k], keys
+			}
+		}
+		return -1, keys
+	}
+
+	flipped := 0
+	for i, read := range reads {
+		joined, keys := find(read)
+		if joined < 0 {
+			rev := GenRevString(read)
+			if c, revkeys := find(rev); c >= 0 {
+				reads[i] = rev
+				joined, keys = c, revkeys
+				flipped++
+			}
+		}
+		if joined < 0 {
+			joined = len(clusters)
+			clusters = append(clusters, nil)
+		}
+		clusters[joined] = append(clusters[joined], i)
+		for _, key := range keys {
+			bucket := buckets[key]
+			if len(bucket) == 0 || bucket[len(bucket)-1] != joined {
+				buckets[key] = append(bucket, joined)
+			}
+		}
+	}
+
+	sort.SliceStable(clusters, func(a, b int) bool {
+		return len(clusters[a]) > len(clusters[b])
+	})
+	return clusters, flipped
+}
+
+// AlignToRef aligns a read to ref with the fewest edits. bases[i] is the read
+// base at ref[i], '-' where it is deleted; ins[i] holds the read bases
+// inserted before ref[i], ins[len(ref)] those after the end.
+func AlignToRef(ref string, read string) ([]byte, []string) {
+	m, n := len(ref), len(read)
+	dp := make([][]int, m+1)
+	for i := range dp {
+		dp[i] = make([]int, n+1)
+		dp[i][0] = i
+	}
+	for j := 0; j <= n; j++ {
+		dp[0][j] = j
+	}
+	for i := 1; i <= m; i++ {
+		for j := 1; j <= n; j++ {
+			cost := 1
+			if ref[i-1] == read[j-1] {
+				cost = 0
+			}
+			dp[i][j] = min(dp[i-1][j-1]+cost, dp[i-1][j]+1, dp[i][j-1]+1)
+		}
+	}
+
+	bases := make([]byte, m)
+	ins := make([]string, m+1)
+	i, j := m, n
+	for i > 0 || j > 0 {
+		if i > 0 && j > 0 {
+			cost := 1
+			if ref[i-1] == read[j-1] {
+				cost = 0
+			}
+			if dp[i][j] == dp[i-1][j-1]+cost {
+				bases[i-1] = read[j-1]
+				i--
+				j--
+				continue
+			}
+		}
+		if i > 0 && dp[i][j] == dp[i-1][j]+1 {
+			bases[i-1] = '-'
+			i--
+		} else {
+			ins[i] = string(read[j-1]) + ins[i]
+			j--
+		}
+	}
+	return bases, ins
+}
+
+// vote rebuilds ref from the majority of reads at every column; an insertion
+// is kept when more than half of the reads have one there. Where as many reads
+// keep a column as delete it, or have an insertion as not, the column follows
+// ref unless flipping it brings the consensus closer to length.
+func vote(ref string, reads []string, length int) string {
+	n := len(ref)
+	baseCount := make([]map[byte]int, n)
+	insCount := make([]map[string]int, n+1)
+	for i := 0; i <= n; i++ {
+		insCount[i] = make(map[string]int)
+		if i < n {
+			baseCount[i] = make(map[byte]int)
+		}
+	}
+	for _, read := range reads {
+		bases, ins := AlignToRef(ref, read)
+		for i := 0; i <= n; i++ {
+			if ins[i] != "" {
+				insCount[i][ins[i]]++
+			}
+			if i < n {
+				baseCount[i][bases[i]]++
+			}
+		}
+	}
+
+	pieces := make([]string, 0, 2*n+1)
+	alts := make(map[int]string)
+	for i := 0; i <= n; i++ {
+		total, best, bestcount := 0, "", 0
+		for s, c := range insCount[i] {
+			total += c
+			if c > bestcount || (c == bestcount && s < best) {
+				best, bestcount = s, c
+			}
+		}
+		if 2*total > len(reads) {
+			pieces = append(pieces, best)
+		} else if 2*total == len(reads) {
+			alts[len(pieces)] = best
+			pieces = append(pieces, "")
+		}
+		if i == n {
+			break
+		}
+		base, count := ref[i], baseCount[i][ref[i]]
+		for b, c := range baseCount[i] {
+			if b != '-' && (c > count || (c == count && base != ref[i] && b < base)) {
+				base, count = b, c
+			}
+		}
+		gap := baseCount[i]['-']
+		if gap > count {
+			continue
+		}
+		if gap == count {
+			alts[len(pieces)] = ""
+		}
+		pieces = append(pieces, string(base))
+	}
+
+	size := 0
+	for _, p := range pieces {
+		size += len(p)
+	}
+	for k := 0; k < len(pieces) && length > 0 && size != length; k++ {
+		alt, ok := alts[k]
+		if !ok {
+			continue
+		}
+		diff := len(alt) - len(pieces[k])
+		if (diff > 0 && size < length) || (diff < 0 && size > length) {
+			pieces[k] = alt
+			size += diff
+		}
+	}
+	return strings.Join(pieces, "")
+}
+
+// Consensus of reads of one strand, starting from the read closest to the
+// others, which tends to carry the fewest errors. length is the strand length
+// if known, or 0.
+func Consensus(reads []string, length int) string {
+	if len(reads) < 3 {
+		return reads[0]
+	}
+	n := min(len(reads), ConsensusMedoidReads)
+	ref, best := reads[0], -1
+	for i := 0; i < n; i++ {
+		sum := 0
+		for j := 0; j < n; j++ {
+			if i != j {
+				dist, _, _, _ := EditingDistance(reads[i], reads[j])
+				sum += dist
+			}
+		}
+		if best < 0 || sum < best {
+			ref, best = reads[i], sum
+		}
+	}
+	for r := 0; r < ConsensusRounds; r++ {
+		ref = vote(ref, reads, length)
+	}
+	return ref
+}
+
+// ModeLength is the most common read length, taken as the strand length.
+func ModeLength(reads []string) int {
+	count := make(map[int]int)
+	mode := 0
+	for _, read := range reads {
+		count[len(read)]++
+		if count[len(read)] > count[mode] || (count[len(read)] == count[mode] && len(read) < mode) {
+			mode = len(read)
+		}
+	}
+	return mode
+}
+
+const ClustersFile = "/Clusters"
+
+// WriteClusters keeps the reads of every cluster, in the order of the
+// consensus reads, for joint decoding.
+func WriteClusters(reads []Read, clusters [][]int, filepath string) error {
+	f, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for c := range clusters {
+		for _, i := range clusters[c] {
+			if _, err := w.WriteString(">cluster_" + strconv.Itoa(c) + " " + reads[i].ID + "\n" + reads[i].Seq + "\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// ReadClusters reads back the clusters of WriteClusters, in order.
+func ReadClusters(filepath string) ([][]string, error) {
+	reads, err := LoadReads(filepath)
+	if err != nil {
+		return nil, err
+	}
+	clusters := make([][]string, 0)
+	header := ""
+	for _, r := range reads {
+		if len(clusters) == 0 || r.ID != header {
+			clusters = append(clusters, nil)
+			header = r.ID
+		}
+		clusters[len(clusters)-1] = append(clusters[len(clusters)-1], r.Seq)
+	}
+	return clusters, nil
+}
+
+// ClusterFile clusters the reads in readpath and writes one consensus per
+// cluster as the noisy reads of the pool in outputpath, and the clusters.
+func ClusterFile(readpath string, outputpath string) error {
+	_, Error_Name, _ := Genfilename(outputpath)
+	records, err := LoadReads(readpath)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", readpath, err)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("%w in %s", ErrNoReads, readpath)
+	}
+	if err := os.MkdirAll(outputpath, 0755); err != nil {
+		return err
+	}
+	reads := Seqs(records)
+	clusters, flipped := ClusterReads(reads)
+	for i := range records {
+		if records[i].Seq != reads[i] {
+			records[i] = records[i].RevComp()
+		}
+	}
+	length := ModeLength(reads)
+
+	seqs := make([]string, len(clusters))
+	var wg sync.WaitGroup
+	wg.Add(len(clusters))
+	ch := make(chan struct{}, runtime.NumCPU())
+	for c := range clusters {
+		index := c
+		ch <- struct{}{}
+		go func() {
+			members := make([]string, len(clusters[index]))
+			for k, i := range clusters[index] {
+				members[k] = reads[i]
+			}
+			seqs[index] = Consensus(members, length)
+			<-ch
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	singletons := 0
+	for _, c := range clusters {
+		if len(c) == 1 {
+			singletons++
+		}
+	}
+	if err := GenFasta(seqs, Error_Name); err != nil {
+		return fmt.Errorf("fail to write %s: %w", Error_Name, err)
+	}
+	if err := WriteClusters(records, clusters, outputpath+ClustersFile); err != nil {
+		return fmt.Errorf("fail to write clusters: %w", err)
+	}
+	fmt.Println("Reads:", len(reads), " Clusters:", len(clusters), " Singletons:", singletons, " Reverse complemented:", flipped)
+	return nil
+}
@@ -0,0 +1,581 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Codec encodes bytes into strands and decodes reads back without touching
+// files; the actions in functions.go are wrappers over it. Progress goes to
+// Log, and nowhere when Log is nil.
+type Codec struct {
+	Params  Params
+	Outer   OuterCode
+	Primers PrimerPair
+	// MaxSeq <= 0 means no limit on the number of data strands.
+	MaxSeq int
+	// Threads sequences are decoded in parallel, ThreadsPerRead threads each.
+	Threads        int
+	ThreadsPerRead int
+	// EDmax 0 raises EDmax round by round until every strand is decoded.
+	EDmax int
+	Log   io.Writer
+}
+
+func NewCodec(params Params) *Codec {
+	return &Codec{Params: params, Threads: 1, ThreadsPerRead: 1}
+}
+
+func (c *Codec) logln(a ...any) {
+	if c.Log != nil {
+		fmt.Fprintln(c.Log, a...)
+	}
+}
+
+// params is Params of c with its primer, checked before any work starts.
+func (c *Codec) params() (Params, error) {
+	if c.Primers.Forward != "" || c.Primers.Reverse != "" {
+		if err := CheckBases("forward primer", c.Primers.Forward); err != nil {
+			return c.Params, err
+		}
+		if err := CheckBases("reverse primer", c.Primers.Reverse); err != nil {
+			return c.Params, err
+		}
+	}
+	params := c.Params.WithPrimer(c.Primers.Seed())
+	if err := params.Validate(); err != nil {
+		return params, err
+	}
+	if err := c.Outer.Validate(); err != nil {
+		return params, err
+	}
+	return params, CheckProfile(params)
+}
+
+// EncodeReader writes the strands of r to w as FASTA, header strands last.
+func (c *Codec) EncodeReader(r io.Reader, w io.Writer) (Manifest, error) {
+	params, err := c.params()
+	if err != nil {
+		return Manifest{}, err
+	}
+	return EncodeStream(r, w, params, c.Outer, c.MaxSeq, c.Threads)
+}
+
+func (c *Codec) EncodeBytes(content []byte) ([]string, Manifest, error) {
+	var buf bytes.Buffer
+	m, err := c.EncodeReader(bytes.NewReader(content), &buf)
+	if err != nil {
+		return nil, m, err
+	}
+	s, err := NewReadScanner(&buf, "strands")
+	if err != nil {
+		return nil, m, err
+	}
+	strands, err := s.All()
+	return Seqs(strands), m, err
+}
+
+// Decoding is the state of a pool being decoded: one block per strand, empty
+// until a read decodes to it, and what became of every read. Hmax is the
+// most hypotheses a round allowed, EDmax that of the last round, Rounds how
+// many rounds ran and Reports how the search went for every read.
+type Decoding struct {
+	Manifest Manifest
+	Params   Params
+	Blocks   []Block
+	Decoded  []bool
+	Reversed []bool
+	Hmax     int
+	EDmax    int
+	Rounds   int
+	Reports  []ReadReport
+}
+
+func (d *Decoding) Failed() int {
+	fail := 0
+	for i := 0; i < len(d.Blocks); i++ {
+		if len(d.Blocks[i].Payload) == 0 {
+			fail++
+		}
+	}
+	return fail
+}
+
+func (d *Decoding) missing() []int {
+	res := make([]int, 0)
+	for i := 0; i < len(d.Blocks); i++ {
+		if len(d.Blocks[i].Payload) == 0 {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// Strands is the decoded pool as Reconstruct takes it: failed strands are zero
+// blocks and the header strands come last.
+func (d *Decoding) Strands() ([]string, error) {
+	res, err := Encode(d.Blocks, d.Params)
+	if err != nil {
+		return nil, err
+	}
+	header, err := d.Manifest.Strands(d.Params.Primer)
+	return append(res, header...), err
+}
+
+// Configure looks for the manifest among the reads, which then overrides
+// Params; FlankLen, Scoring and MinConfidence describe the reads and the
+// search and are kept. Without a manifest, Defaulted Params fail.
+// Reads flagged in the result carry the manifest.
+func (c *Codec) Configure(reads []Read) (Manifest, []bool, Params, error) {
+	params, err := c.params()
+	if err != nil {
+		return Manifest{}, nil, params, err
+	}
+	if params.SkipManifest {
+		c.logln("Decoding with given parameters!")
+		return Manifest{}, make([]bool, len(reads)), params, nil
+	}
+	manifest, isheader, err := DecodeManifest(Seqs(reads), params.Primer, params.FlankLen, c.Threads)
+	if err == nil {
+		var found Params
+		found, err = manifest.Params()
+		if err == nil {
+			params = found.WithPrimer(params.Primer).WithFlank(params.FlankLen).WithScoring(params.Scoring).WithConfidence(params.MinConfidence)
+			c.logln("Manifest found! Strand Num:", manifest.StrandNum, " File Length:", manifest.FileLen)
+			return manifest, isheader, params, CheckProfile(params)
+		}
+		manifest = Manifest{}
+	}
+	if params.Defaulted {
+		c.logln("Manifest not found! Give -option, -density and -length to decode without it")
+		return manifest, isheader, params, err
+	}
+	c.logln(err)
+	c.logln("Decoding with given parameters!")
+	return manifest, isheader, params, nil
+}
+
+func (c *Codec) DecodeReader(r io.Reader) (*Decoding, error) {
+	s, err := NewReadScanner(r, "reads")
+	if err != nil {
+		return nil, err
+	}
+	reads, err := s.All()
+	if err != nil {
+		return nil, err
+	}
+	return c.DecodeReads(reads)
+}
+
+// DecodeReads decodes reads in rounds of more hypotheses, at a fixed EDmax or
+// one that advances; the reads of each round are those still undecoded.
+func (c *Codec) DecodeReads(reads []Read) (*Decoding, error) {
+	if len(reads) == 0 {
+		return nil, ErrNoReads
+	}
+	if err := CheckReads(reads); err != nil {
+		return nil, err
+	}
+	reads, clipped := ClipReads(reads)
+	d, err := c.configure(reads, clipped)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.EDmax > 0 {
+		c.decodeFixed(reads, d)
+	} else {
+		c.decodeAdvancing(reads, d)
+	}
+	return d, nil
+}
+
+// configure starts the Decoding of reads once the manifest is looked for.
+func (c *Codec) configure(reads []Read, clipped []bool) (*Decoding, error) {
+	manifest, isheader, params, err := c.Configure(reads)
+	if err != nil {
+		return nil, err
+	}
+
+	strandnum := len(reads) - CountTrue(isheader)
+	if manifest.Found() {
+		strandnum = manifest.StrandNum
+	}
+	d := &Decoding{
+		Manifest: manifest,
+		Params:   params,
+		Blocks:   make([]Block, strandnum),
+		Decoded:  make([]bool, len(reads)),
+		Reversed: make([]bool, len(reads)),
+		Reports:  NewReadReports(reads),
+	}
+	// header reads count as decoded so that the rounds skip them
+	copy(d.Decoded, isheader)
+	for i := 0; i < len(reads); i++ {
+		d.Reports[i].Header = isheader[i]
+		d.Reports[i].Clipped = clipped[i]
+	}
+	if n := CountTrue(clipped); n > 0 {
+		c.logln("Reads longer than", MaxReadLen, "bases clipped:", n)
+	}
+	return d, nil
+}
+
+// DecodeClusters decodes all reads of each cluster together, clusters[i]
+// being the reads behind the consensus read reads[i] that Cluster writes.
+// EDmax (per read) is raised over SearchEDmaxSet until every cluster is
+// decoded, and each cluster is reported under its consensus read. Every edit
+// counts as one, so Scoring and FlankLen are refused and qualities ignored.
+func (c *Codec) DecodeClusters(reads []Read, clusters [][]string) (*Decoding, error) {
+	if len(reads) == 0 {
+		return nil, ErrNoReads
+	}
+	if len(clusters) != len(reads) {
+		return nil, ErrClusters
+	}
+	if c.Params.Scoring != nil || c.Params.FlankLen != 0 {
+		return nil, &ParamsError{Msg: "joint decoding counts every edit as one and takes no scoring or flank"}
+	}
+	if err := CheckReads(reads); err != nil {
+		return nil, err
+	}
+	if reads[0].Qual != nil {
+		c.logln("Joint decoding counts every edit as one, base qualities are ignored")
+	}
+	reads, clipped := ClipReads(reads)
+	clusters = clipClusters(clusters, clipped)
+	d, err := c.configure(reads, clipped)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, EDmax := range SearchEDmaxSet {
+		if EDmax > int(0.2*float64(d.Params.MaxDepth)) {
+			break
+		}
+		if c.jointRound(clusters, d, EDmax) == 0 {
+			break
+		}
+	}
+	return d, nil
+}
+
+// clipClusters cuts the cluster reads longer than MaxReadLen as ClipReads
+// does, and marks their clusters in clipped.
+func clipClusters(clusters [][]string, clipped []bool) [][]string {
+	res := make([][]string, len(clusters))
+	for i := 0; i < len(clusters); i++ {
+		res[i] = clusters[i]
+		for k := 0; k < len(clusters[i]); k++ {
+			if len(clusters[i][k]) <= MaxReadLen {
+				continue
+			}
+			if &res[i][0] == &clusters[i][0] {
+				res[i] = append([]string{}, clusters[i]...)
+			}
+			res[i][k] = clusters[i][k][:MaxReadLen]
+			clipped[i] = true
+		}
+	}
+	return res
+}
+
+// jointRound decodes the undecoded clusters, then the reverse complements of
+// those that fail, and returns how many clusters are still undecoded.
+func (c *Codec) jointRound(clusters [][]string, d *Decoding, EDmax int) int {
+	d.Hmax = max(d.Hmax, Maxhypo_firstround)
+	d.EDmax = EDmax
+	d.Rounds++
+	set := &IDtobeDecode{}
+	set.InitWithtempset(len(d.Blocks), d.missing())
+
+	tobefix := make([][]string, 0)
+	tobefixID := make([]int, 0)
+	for i := 0; i < len(clusters); i++ {
+		if !d.Decoded[i] {
+			tobefix = append(tobefix, clusters[i])
+			tobefixID = append(tobefixID, i)
+		}
+	}
+	if len(tobefix) == 0 {
+		return 0
+	}
+
+	stats := NewSearchStats(len(tobefix))
+	deco, suc := Decode_Joint_Parallel(tobefix, stats, Maxhypo_firstround, c.Threads, EDmax, set, d.Params)
+
+	// clusters whose reads came back reverse complemented
+	rev := make([][]string, 0)
+	revID := make([]int, 0)
+	for i := 0; i < len(tobefix); i++ {
+		if !suc[i] {
+			reads := make([]string, len(tobefix[i]))
+			for j := range reads {
+				reads[j] = GenRevString(tobefix[i][j])
+			}
+			rev = append(rev, reads)
+			revID = append(revID, i)
+		}
+	}
+	rev_stats := NewSearchStats(len(rev))
+	rev_deco, rev_suc := Decode_Joint_Parallel(rev, rev_stats, Maxhypo_reverse, c.Threads, EDmax, set, d.Params)
+	reversed := make([]bool, len(tobefix))
+	for i := 0; i < len(rev); i++ {
+		stats[revID[i]].Add(rev_stats[i])
+		if rev_suc[i] {
+			deco[revID[i]], suc[revID[i]] = rev_deco[i], true
+			reversed[revID[i]] = true
+		}
+	}
+
+	fixed, refused := 0, 0
+	for i := 0; i < len(tobefix); i++ {
+		if stats[i].Refused {
+			refused++
+		}
+		kept := suc[i] && deco[i].BlockID < len(d.Blocks)
+		if kept {
+			d.Decoded[tobefixID[i]] = true
+			d.Reversed[tobefixID[i]] = reversed[i]
+			if len(d.Blocks[deco[i].BlockID].Payload) == 0 {
+				d.Blocks[deco[i].BlockID] = deco[i]
+			}
+			fixed++
+		}
+		d.Reports[tobefixID[i]].Record(stats[i], kept, deco[i].BlockID, reversed[i], d.Rounds, Maxhypo_firstround, EDmax)
+	}
+	c.logln(len(tobefix), " clusters with no output, ", fixed, " decoded at Edit Distance upperbound: ", EDmax)
+	c.logln("Reverse complemented clusters:", CountTrue(d.Reversed))
+	if d.Params.MinConfidence > 0 {
+		c.logln("Clusters refused under confidence", d.Params.MinConfidence, ":", refused)
+	}
+	return len(tobefix) - fixed
+}
+
+// decodeRounds follow the first round of each EDmax, each once the share of
+// failed strands is below its bound and still falling.
+var decodeRounds = []struct {
+	name  string
+	Hmax  int
+	bound float64
+}{
+	{"Second", Maxhypo_secondround, 0.5},
+	{"Third", Maxhypo_thirdround, 0.2},
+	{"Forth", Maxhypo_forthround, 0.1},
+	{"Fifth", Maxhypo_ultra, 0.01},
+}
+
+func (c *Codec) decodeAdvancing(reads []Read, d *Decoding) {
+	total := len(d.Blocks)
+	old_fail := total
+	for EDmax := 3; EDmax <= int(0.2*float64(d.Params.MaxDepth)); EDmax++ {
+		fail := c.round(reads, d, Maxhypo_firstround, EDmax)
+		c.logln("First round Finished at Edit Distance upperbound: ", EDmax)
+
+		if fail < old_fail {
+			for _, r := range decodeRounds {
+				if float64(fail)/float64(total) < r.bound && fail < old_fail {
+					old_fail = fail
+					c.logln(r.name + " round begin!")
+					fail = c.round(reads, d, r.Hmax, EDmax)
+					c.logln(r.name+" round Finished at Edit Distance upperbound: ", EDmax)
+				}
+			}
+		} else {
+			c.logln("Fail to decode at Edit Distance upperbound: ", EDmax)
+		}
+
+		old_fail = fail
+		if fail == 0 {
+			break
+		}
+	}
+}
+
+func (c *Codec) decodeFixed(reads []Read, d *Decoding) {
+	c.logln("First round begin!")
+	c.round(reads, d, Maxhypo_firstround, c.EDmax)
+	c.logln("First round finish!")
+	for _, r := range decodeRounds[:3] {
+		c.logln(r.name + " round begin!")
+		c.round(reads, d, r.Hmax, c.EDmax)
+		c.logln(r.name + " round finish!")
+	}
+}
+
+// round decodes the undecoded reads, only as strands not yet found, and
+// returns how many strands are still missing.
+func (c *Codec) round(reads []Read, d *Decoding, Hmax int, EDmax int) int {
+	d.Hmax = max(d.Hmax, Hmax)
+	d.EDmax = EDmax
+	d.Rounds++
+	set := &IDtobeDecode{}
+	set.InitWithtempset(len(d.Blocks), d.missing())
+
+	tobefix := make([]Read, 0)
+	tobefixID := make([]int, 0)
+	for i := 0; i < len(reads); i++ {
+		if !d.Decoded[i] {
+			tobefix = append(tobefix, reads[i])
+			tobefixID = append(tobefixID, i)
+		}
+	}
+	c.logln(len(tobefix), " sequences with no output! Hmax:", Hmax)
+
+	stats := NewSearchStats(len(tobefix))
+	deco, deco_suc, reversed := DecodeOriented(tobefix, stats, Hmax, c.Threads, c.ThreadsPerRead, EDmax, set, d.Params)
+	refused := 0
+	for i := 0; i < len(tobefix); i++ {
+		if stats[i].Refused {
+			refused++
+		}
+		kept := deco_suc[i] && deco[i].BlockID < len(d.Blocks)
+		if kept {
+			d.Decoded[tobefixID[i]] = true
+			d.Reversed[tobefixID[i]] = reversed[i]
+			if len(d.Blocks[deco[i].BlockID].Payload) == 0 {
+				d.Blocks[deco[i].BlockID] = deco[i]
+			}
+		}
+		d.Reports[tobefixID[i]].Record(stats[i], kept, deco[i].BlockID, reversed[i], d.Rounds, Hmax, EDmax)
+	}
+
+	fail := d.Failed()
+	c.logln("Total Sequences:", len(d.Blocks), " Failure Sequnces:", fail, " Reverse complemented reads:", CountTrue(d.Reversed))
+	if d.Params.MinConfidence > 0 {
+		c.logln("Reads refused under confidence", d.Params.MinConfidence, ":", refused)
+	}
+	return fail
+}
+
+// Pool is a decoded pool read back into blocks by BlockID, after the outer
+// code and the fountain have filled in what they can.
+type Pool struct {
+	Manifest  Manifest
+	Params    Params
+	Blocks    []Block
+	BlockBits int
+}
+
+// Recover reads the strands of a decoded pool, header strands last. Without
+// a manifest, Params of c describe the pool unless they are Defaulted.
+func (c *Codec) Recover(strands []string) (Pool, error) {
+	for i := 0; i < len(strands); i++ {
+		if len(strands[i]) > MaxReadLen {
+			return Pool{}, &LengthError{What: fmt.Sprintf("strand %d", i), Got: len(strands[i]), Want: MaxReadLen, AtMost: true}
+		}
+	}
+	params, err := c.params()
+	if err != nil {
+		return Pool{}, err
+	}
+	dec_seqs, _, manifest, ok := SplitPool(strands, params.Primer, c.Threads)
+	if len(dec_seqs) == 0 {
+		return Pool{}, ErrNoReads
+	}
+
+	if ok {
+		var found Params
+		found, err = manifest.Params()
+		ok = err == nil
+		if ok {
+			params = found.WithPrimer(params.Primer)
+		}
+	}
+	if !ok {
+		if params.Defaulted {
+			c.logln("Manifest not found! Give -option, -density and -length to reconstruct without it")
+			if err == nil {
+				err = ErrManifestNotFound
+			}
+			return Pool{}, err
+		}
+		manifest = Manifest{}
+		c.logln("Manifest not found! Reconstructing with given parameters")
+	}
+	if err := CheckProfile(params); err != nil {
+		return Pool{}, err
+	}
+
+	set := &IDtobeDecode{}
+	set.Init(len(dec_seqs))
+	var datablock []Block
+	var data_suc []bool
+	if params.Option != Gungnir_Trit_Params {
+		datablock, data_suc = Decode_Parallel(dec_seqs, nil, nil, Maxhypo_simple, c.Threads, 100, set, params)
+	} else {
+		datablock, data_suc = Decode_Three_Parallel(dec_seqs, nil, nil, Maxhypo_simple, c.Threads, 100, set, params)
+	}
+	for i := 0; i < len(data_suc); i++ {
+		if !data_suc[i] {
+			datablock[i].BlockID = -1
+		}
+	}
+
+	p := Pool{Manifest: manifest, Params: params, Blocks: SortBlocks(datablock, len(dec_seqs)), BlockBits: params.PayloadLen}
+	if manifest.Outer.Enabled() {
+		var recovered int
+		p.Blocks, recovered = manifest.Outer.Recover(p.Blocks, params)
+		p.BlockBits = manifest.BlockBits()
+		c.logln("Strands recovered by parity:", recovered)
+	}
+	if manifest.Fountain {
+		var recovered int
+		p.Blocks, recovered = PeelDroplets(p.Blocks, manifest.SourceNum(), params)
+		c.logln("Source blocks recovered:", recovered, "/", manifest.SourceNum())
+	}
+	return p, nil
+}
+
+// Content is the file the pool holds. With a manifest it is cut to the file
+// length, and returned with ErrDigestMismatch when its digest differs.
+// Archives are restored with RestoreArchive instead.
+func (p Pool) Content() ([]byte, error) {
+	if p.Manifest.IsArchive() {
+		return nil, ErrArchive
+	}
+	content := BlocksintoData(p.Blocks, p.BlockBits, p.Params).Bytes()
+	if p.Manifest.Found() {
+		if len(content) > p.Manifest.FileLen {
+			content = content[:p.Manifest.FileLen]
+		}
+		if !p.Manifest.CheckDigest(content) {
+			return content, ErrDigestMismatch
+		}
+	}
+	return content, nil
+}
+
+func (c *Codec) Reconstruct(strands []string) ([]byte, error) {
+	p, err := c.Recover(strands)
+	if err != nil {
+		return nil, err
+	}
+	return p.Content()
+}
@@ -0,0 +1,70 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import "math"
+
+// ConfidenceOdds is how many times less likely a strand is for every full
+// edit more it takes to explain the read.
+const ConfidenceOdds = 10.0
+
+// WithConfidence refuses to emit a strand the decoder is less confident in
+// than minconfidence, from 0 to 1; 0 emits every strand found.
+func (params Params) WithConfidence(minconfidence float64) Params {
+	params.MinConfidence = minconfidence
+	return params
+}
+
+// Confidence is the share of the best strand in the likelihood of all the
+// strands that explain the read, given their penalties in increasing order
+// and the cost of a full edit: 1 when no other strand does, 1/2 for a tie.
+func Confidence(penalties []int, unit int) float64 {
+	if len(penalties) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, p := range penalties {
+		sum += math.Pow(ConfidenceOdds, -float64(p-penalties[0])/float64(unit))
+	}
+	return 1 / sum
+}
+
+// Judge weighs the strands that reached MaxDepth, by their penalties in
+// increasing order, and tells whether the best one is to be emitted.
+func (c ReadCost) Judge(penalties []int, params Params) bool {
+	confidence := Confidence(penalties, c.Unit)
+	ok := confidence >= params.MinConfidence
+	if c.Stats != nil {
+		c.Stats.Candidates = len(penalties)
+		c.Stats.RunnerUp = -1
+		if len(penalties) > 1 {
+			c.Stats.RunnerUp = penalties[1]
+		}
+		c.Stats.Confidence = confidence
+		c.Stats.Refused = !ok
+	}
+	return ok
+}
@@ -37,6 +37,7 @@ type Hypothesis struct {
 	Info    int
 	Penalty int
 	Bits    []int
+	Kmer    int
 }
 
 func (hypo *Hypothesis) Pattern(params Params) int {
@@ -198,47 +199,31 @@ func (hypo *Hypothesis) GenPrevious(params Params) int {
 	return res
 }
 
-func (hypo *Hypothesis) GenHash0(params Params) []int {
-	res := make([]int, params.HashLenSet[0])
-
-	for i := 0; i < len(res); i++ {
-		res[i] = hypo.Selectbits(i)
-	}
-	return res
+func (hypo *Hypothesis) GenHash0(params Params) Bitset {
+	return BitsetFromWords(hypo.Bits, 0, params.HashLenSet[0])
 }
 
-func (hypo *Hypothesis) GenHashIndex(hashindex int, params Params) []int {
-	res := make([]int, params.HashLenSet[hashindex])
+func (hypo *Hypothesis) GenHashIndex(hashindex int, params Params) Bitset {
 	previousLen := params.HashLenSet[0]
 	for i := 1; i < hashindex; i++ {
 		previousLen += params.HashLenSet[i]
 		previousLen += params.PayloadLenSet[i]
 	}
 
-	for i := 0; i < len(res); i++ {
-		res[i] = hypo.Selectbits(previousLen + i)
-	}
-	return res
+	return BitsetFromWords(hypo.Bits, previousLen, previousLen+params.HashLenSet[hashindex])
 }
 
-func (hypo *Hypothesis) GenPayload0(params Params) []int {
-	res := make([]int, params.PayloadLenSet[0])
-
+func (hypo *Hypothesis) GenPayload0(params Params) Bitset {
 	previousLen := params.HashLenSet[0]
 	for i := 1; i < len(params.PayloadLenSet); i++ {
 		previousLen += params.HashLenSet[i]
 		previousLen += params.PayloadLenSet[i]
 	}
 
-	for i := 0; i < len(res); i++ {
-		res[i] = hypo.Selectbits(previousLen + i)
-	}
-	return res
+	return BitsetFromWords(hypo.Bits, previousLen, previousLen+params.PayloadLenSet[0])
 }
 
-func (hypo *Hypothesis) GenPayloadIndex(payloadindex int, params Params) []int {
-	res := make([]int, params.PayloadLenSet[payloadindex])
-
+func (hypo *Hypothesis) GenPayloadIndex(payloadindex int, params Params) Bitset {
 	previousLen := params.HashLenSet[0]
 	for i := 1; i < payloadindex; i++ {
 		previousLen += params.HashLenSet[i]
@@ -246,14 +231,11 @@ func (hypo *Hypothesis) GenPayloadIndex(payloadindex int, params Params) []int {
 	}
 	previousLen += params.HashLenSet[payloadindex]
 
-	for i := 0; i < len(res); i++ {
-		res[i] = hypo.Selectbits(previousLen + i)
-	}
-	return res
+	return BitsetFromWords(hypo.Bits, previousLen, previousLen+params.PayloadLenSet[payloadindex])
 }
 
-func (hypo *Hypothesis) GenPayload(params Params) [][]int {
-	res := make([][]int, len(params.PayloadLenSet))
+func (hypo *Hypothesis) GenPayload(params Params) []Bitset {
+	res := make([]Bitset, len(params.PayloadLenSet))
 
 	res[0] = hypo.GenPayload0(params)
 
@@ -315,9 +297,10 @@ func Runes2Pattern(p []rune, params Params) int {
 
 func Genroothypo(data map[string]Kmer, strandID int, params Params) Hypothesis {
 	var hypo Hypothesis
-	pattern := Runes2Pattern([]rune(InitPattern(params.PreviousNuc)), params)
+	pattern := Runes2Pattern([]rune(PrimerPattern(params.Primer, params.PreviousNuc)), params)
 	hypo.Penalty = 0.0
 	hypo.Info = hypo.BuildInfo(pattern, 0, 0, Uint9Mask, strandID, params)
+	hypo.Kmer = KmerIndex(params.Primer)
 	hypo.Bits = make([]int, params.Necessary_Decoding_Ints)
 	for i := 0; i < params.Necessary_Decoding_Ints; i++ {
 		hypo.Bits[i] = 0
@@ -325,7 +308,7 @@ func Genroothypo(data map[string]Kmer, strandID int, params Params) Hypothesis {
 	return hypo
 }
 
-func (hypo *Hypothesis) Addchild(DataC []rune, data map[string]Kmer, EDmax int, params Params) []Hypothesis {
+func (hypo *Hypothesis) Addchild(DataC []rune, cost ReadCost, data map[string]Kmer, EDmax int, params Params) []Hypothesis {
 	res := make([]Hypothesis, 0)
 	if hypo.Depth(params) == params.MaxDepth {
 		return []Hypothesis{*hypo}
@@ -361,6 +344,7 @@ func (hypo *Hypothesis) Addchild(DataC []rune, data map[string]Kmer, EDmax int,
 		ThisC := potentialC[i] // updated
 
 		x_pattern := ((pattern << 2) + Nuc2Int(ThisC)) & params.PatternMask
+		childX.Kmer = ((hypo.Kmer << 2) + Nuc2Int(ThisC)) & KmerMask
 
 		if potentialC[i] == 'C' || potentialC[i] == 'G' {
 			x_gc += 1
@@ -369,17 +353,21 @@ func (hypo *Hypothesis) Addchild(DataC []rune, data map[string]Kmer, EDmax int,
 		if ThisC == DataC[x_index] {
 			childX.Penalty = hypo.Penalty
 		} else {
-			childX.Penalty = hypo.Penalty + 1.0 // - math.Log(data[string(append(previous, childX[i].ThisC))].X_rate)
+			childX.Penalty = hypo.Penalty + cost.Sub(x_index, childX.Kmer, params)
 		}
 
 		if x_depth == params.MaxDepth {
-			childX.Penalty += (len(DataC) - 1 - x_index)
+			childX.Penalty += cost.Tail(x_index+1, params)
 			x_index = len(DataC) - 1
 		}
 
 		childX.Info = childX.BuildInfo(x_pattern, x_gc, x_depth, x_index, strandID, params)
-		if childX.Penalty < EDmax+1 && childX.CheckHash(params) {
-			res = append(res, childX)
+		if childX.Penalty < cost.Bound(EDmax) {
+			if childX.CheckHash(params) {
+				res = append(res, childX)
+			} else {
+				cost.Stats.reject(x_depth)
+			}
 		}
 	}
 
@@ -400,20 +388,25 @@ func (hypo *Hypothesis) Addchild(DataC []rune, data map[string]Kmer, EDmax int,
 		ThisC := potentialC[i]
 
 		d_pattern := ((pattern << 2) + Nuc2Int(ThisC)) & params.PatternMask
-		childD.Penalty = hypo.Penalty + 1.0 // - math.Log(data[string(append(previous, childD[i].ThisC))].D_rate)
+		childD.Kmer = ((hypo.Kmer << 2) + Nuc2Int(ThisC)) & KmerMask
+		childD.Penalty = hypo.Penalty + cost.Del(childD.Kmer, params)
 
 		if potentialC[i] == 'C' || potentialC[i] == 'G' {
 			d_gc += 1
 		}
 
 		if d_depth == params.MaxDepth {
-			childD.Penalty += len(DataC) - 1 - d_index
+			childD.Penalty += cost.Tail((d_index+1)&Uint9Mask, params)
 			d_index = len(DataC) - 1
 		}
 
 		childD.Info = childD.BuildInfo(d_pattern, d_gc, d_depth, d_index, strandID, params)
-		if childD.Penalty < EDmax+1 && childD.CheckHash(params) {
-			res = append(res, childD)
+		if childD.Penalty < cost.Bound(EDmax) {
+			if childD.CheckHash(params) {
+				res = append(res, childD)
+			} else {
+				cost.Stats.reject(d_depth)
+			}
 		}
 	}
 
@@ -428,10 +421,14 @@ func (hypo *Hypothesis) Addchild(DataC []rune, data map[string]Kmer, EDmax int,
 			childI.Bits[i] = hypo.Bits[i]
 		}
 
-		childI.Penalty = hypo.Penalty + 1.0 // - math.Log(data[string(append(hypo.Previousinfo, hypo.ThisC))].I_rate)
+		childI.Kmer = hypo.Kmer
+		childI.Penalty = hypo.Penalty + cost.Ins(i_index&Uint9Mask, hypo.Kmer, params)
+		if params.LeadFree(depth, i_index&Uint9Mask) {
+			childI.Penalty = hypo.Penalty
+		}
 
 		childI.Info = childI.BuildInfo(pattern, gc, depth, i_index, strandID, params)
-		if childI.Penalty < EDmax+1 {
+		if childI.Penalty < cost.Bound(EDmax) {
 			res = append(res, childI)
 		}
 	}
@@ -445,7 +442,7 @@ func (hypo *Hypothesis) Traceback(params Params) (b Block) {
 	}
 	b.BlockID = hypo.GenStrandID(params)
 	b.Payload = hypo.GenPayload(params)
-	b.Hash = make([][]int, len(params.HashLenSet))
+	b.Hash = make([]Bitset, len(params.HashLenSet))
 	b.Hash[0] = hypo.GenHash0(params)
 	for i := 1; i < len(b.Hash); i++ {
 		b.Hash[i] = hypo.GenHashIndex(i, params)
@@ -454,7 +451,8 @@ func (hypo *Hypothesis) Traceback(params Params) (b Block) {
 	return
 }
 
-func Updateinfo_Multithread(consensus []rune, Maxhypo int, data map[string]Kmer, EDmax int, threads_num int, set *IDtobeDecode, params Params) (b Block, suc bool) {
+func Updateinfo_Multithread(consensus []rune, cost ReadCost, Maxhypo int, data map[string]Kmer, EDmax int, threads_num int, set *IDtobeDecode, params Params) (b Block, suc bool) {
+	start := cost.Stats.begin(cost, params)
 	var hypotree_plist PlistWithLock
 	hypotree_plist.Init(data, set, params)
 
@@ -478,7 +476,7 @@ func Updateinfo_Multithread(consensus []rune, Maxhypo int, data map[string]Kmer,
 				this_hypo := make([]Hypothesis, 0)
 
 				for k := 0; k < num_thistask; k++ {
-					temp := hypotree_plist.shards[index].hypos[k].Addchild(consensus, data, EDmax, params)
+					temp := hypotree_plist.shards[index].hypos[k].Addchild(consensus, cost, data, EDmax, params)
 					if temp != nil {
 						this_hypo = append(this_hypo, temp...)
 					}
@@ -514,7 +512,9 @@ func Updateinfo_Multithread(consensus []rune, Maxhypo int, data map[string]Kmer,
 
 		wg.Wait()
 
+		task := 0
 		for j := 0; j < hypotree_plist.shardCount; j++ {
+			task += len(hypotree_plist.shards[j].hypos)
 			hypotree_plist.shards[j].hypos = nil
 		}
 
@@ -522,10 +522,11 @@ func Updateinfo_Multithread(consensus []rune, Maxhypo int, data map[string]Kmer,
 		for k := 0; k < hypotree_qlist.shardCount; k++ {
 			totalvalidnum += hypotree_qlist.shards[k].valid_num
 		}
+		cost.Stats.expand(task, totalvalidnum)
 
 		if totalvalidnum > Maxhypo {
 
-			uppbound := EDmax + 2
+			uppbound := cost.Bound(EDmax) + 1
 			sumlist := make([]int, uppbound)
 			for k := 0; k < uppbound; k++ {
 				sumlist[k] = 0
@@ -606,6 +607,7 @@ func Updateinfo_Multithread(consensus []rune, Maxhypo int, data map[string]Kmer,
 							hypotree_plist.shards[index].hypos[iterator] = Hypothesis{Info: hypotree_qlist.shards[index].hypos[k].Info,
 								Penalty: hypotree_qlist.shards[index].hypos[k].Penalty,
 								Bits:    newbits,
+								Kmer:    hypotree_qlist.shards[index].hypos[k].Kmer,
 							}
 							iterator += 1
 						}
@@ -640,22 +642,34 @@ func Updateinfo_Multithread(consensus []rune, Maxhypo int, data map[string]Kmer,
 
 	suc = false
 
+	best := -1
+	penalties := make([]int, 0)
 	for i := 0; i < len(final_hypos); i++ {
 		if final_hypos[i].Depth(params) == params.MaxDepth {
-			strandID := final_hypos[i].GenStrandID(params)
-			set.dataLock.Lock()
-			set.IDset[strandID] = true
-			set.dataLock.Unlock()
-			b = final_hypos[i].Traceback(params)
-			suc = true
-			return
+			if best < 0 {
+				best = i
+			}
+			penalties = append(penalties, final_hypos[i].Penalty)
 		}
 	}
 
+	if best >= 0 && cost.Judge(penalties, params) {
+		strandID := final_hypos[best].GenStrandID(params)
+		set.dataLock.Lock()
+		set.IDset[strandID] = true
+		set.dataLock.Unlock()
+		b = final_hypos[best].Traceback(params)
+		suc = true
+		cost.Stats.end(start, final_hypos[best].Penalty, suc)
+		return
+	}
+
+	cost.Stats.end(start, 0, suc)
 	return
 }
 
-func Updateinfo_Singlethread(consensus []rune, Maxhypo int, data map[string]Kmer, EDmax int, set *IDtobeDecode, params Params) (b Block, suc bool) {
+func Updateinfo_Singlethread(consensus []rune, cost ReadCost, Maxhypo int, data map[string]Kmer, EDmax int, set *IDtobeDecode, params Params) (b Block, suc bool) {
+	start := cost.Stats.begin(cost, params)
 
 	hypotree_plist := make([]Hypothesis, 0)
 	set.dataLock.Lock()
@@ -677,7 +691,7 @@ func Updateinfo_Singlethread(consensus []rune, Maxhypo int, data map[string]Kmer
 		task := len(hypotree_plist)
 
 		for j := 0; j < task; j++ {
-			temp := hypotree_plist[j].Addchild(consensus, data, EDmax, params)
+			temp := hypotree_plist[j].Addchild(consensus, cost, data, EDmax, params)
 			if temp != nil {
 				for k := 0; k < len(temp); k++ {
 					key := temp[k].CalKey(params)
@@ -695,11 +709,12 @@ func Updateinfo_Singlethread(consensus []rune, Maxhypo int, data map[string]Kmer
 
 		}
 
+		cost.Stats.expand(task, hypotree_qlist.valid_num)
 		hypotree_plist = nil
 
 		if hypotree_qlist.valid_num > Maxhypo {
 
-			uppbound := EDmax + 2
+			uppbound := cost.Bound(EDmax) + 1
 			sumlist := make([]int, uppbound)
 			for k := 0; k < uppbound; k++ {
 				sumlist[k] = 0
@@ -737,7 +752,7 @@ func Updateinfo_Singlethread(consensus []rune, Maxhypo int, data map[string]Kmer
 				if hypotree_qlist.hypos[k].Penalty <= maxpenal {
 					hypotree_plist[iterator] = Hypothesis{
 						Info: hypotree_qlist.hypos[k].Info, Penalty: hypotree_qlist.hypos[k].Penalty,
-						Bits: newbits,
+						Bits: newbits, Kmer: hypotree_qlist.hypos[k].Kmer,
 					}
 					iterator += 1
 				}
@@ -754,23 +769,34 @@ func Updateinfo_Singlethread(consensus []rune, Maxhypo int, data map[string]Kmer
 
 	suc = false
 
+	best := -1
+	penalties := make([]int, 0)
 	for i := 0; i < len(hypotree_plist); i++ {
 		if hypotree_plist[i].Depth(params) == params.MaxDepth {
-			strandID := hypotree_plist[i].GenStrandID(params)
-			set.dataLock.Lock()
-			set.IDset[strandID] = true
-			set.dataLock.Unlock()
-			b = hypotree_plist[i].Traceback(params)
-			suc = true
-			return
+			if best < 0 {
+				best = i
+			}
+			penalties = append(penalties, hypotree_plist[i].Penalty)
 		}
 	}
 
+	if best >= 0 && cost.Judge(penalties, params) {
+		strandID := hypotree_plist[best].GenStrandID(params)
+		set.dataLock.Lock()
+		set.IDset[strandID] = true
+		set.dataLock.Unlock()
+		b = hypotree_plist[best].Traceback(params)
+		suc = true
+		cost.Stats.end(start, hypotree_plist[best].Penalty, suc)
+		return
+	}
+
+	cost.Stats.end(start, 0, suc)
 	return
 }
 
-func Decode_Multithread(Consensus []string, Maxhypo int, threads_num int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
-	data, _ := Readjson()
+func Decode_Multithread(Consensus []string, Quals [][]int, Stats []SearchStats, Maxhypo int, threads_num int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
+	data := Profile()
 	blocknum := len(Consensus)
 	bit_stream := make([]Block, blocknum)
 	decode_res := make([]bool, blocknum)
@@ -779,7 +805,7 @@ func Decode_Multithread(Consensus []string, Maxhypo int, threads_num int, EDmax
 
 	for i := 0; i < blocknum; i++ {
 		var temp Block
-		temp, decode_res[i] = Updateinfo_Multithread([]rune(Consensus[i]), Maxhypo, data, EDmax, threads_num, set, params)
+		temp, decode_res[i] = Updateinfo_Multithread([]rune(Consensus[i]), CostAt(Consensus, Quals, Stats, i, params), Maxhypo, data, EDmax, threads_num, set, params)
 		if decode_res[i] {
 			bit_stream[i] = temp
 		}
@@ -788,8 +814,8 @@ func Decode_Multithread(Consensus []string, Maxhypo int, threads_num int, EDmax
 	return bit_stream, decode_res
 }
 
-func Decode_Parallel(Consensus []string, Maxhypo int, threads_num int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
-	data, _ := Readjson()
+func Decode_Parallel(Consensus []string, Quals [][]int, Stats []SearchStats, Maxhypo int, threads_num int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
+	data := Profile()
 	blocknum := len(Consensus)
 	bit_stream := make([]Block, blocknum)
 	decode_res := make([]bool, blocknum)
@@ -806,7 +832,7 @@ func Decode_Parallel(Consensus []string, Maxhypo int, threads_num int, EDmax int
 		go func() {
 
 			var temp Block
-			temp, decode_res[index] = Updateinfo_Singlethread([]rune(Consensus[index]), Maxhypo, data, EDmax, set, params)
+			temp, decode_res[index] = Updateinfo_Singlethread([]rune(Consensus[index]), CostAt(Consensus, Quals, Stats, index, params), Maxhypo, data, EDmax, set, params)
 			if decode_res[index] {
 				bit_stream[index] = temp
 			}
@@ -821,8 +847,8 @@ func Decode_Parallel(Consensus []string, Maxhypo int, threads_num int, EDmax int
 	return bit_stream, decode_res
 }
 
-func Decode_Mix(Consensus []string, Maxhypo int, threads_num1 int, threads_num2 int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
-	data, _ := Readjson()
+func Decode_Mix(Consensus []string, Quals [][]int, Stats []SearchStats, Maxhypo int, threads_num1 int, threads_num2 int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
+	data := Profile()
 	blocknum := len(Consensus)
 	bit_stream := make([]Block, blocknum)
 	decode_res := make([]bool, blocknum)
@@ -839,7 +865,7 @@ func Decode_Mix(Consensus []string, Maxhypo int, threads_num1 int, threads_num2
 		go func() {
 
 			var temp Block
-			temp, decode_res[index] = Updateinfo_Multithread([]rune(Consensus[index]), Maxhypo, data, EDmax, threads_num2, set, params)
+			temp, decode_res[index] = Updateinfo_Multithread([]rune(Consensus[index]), CostAt(Consensus, Quals, Stats, index, params), Maxhypo, data, EDmax, threads_num2, set, params)
 			if decode_res[index] {
 				bit_stream[index] = temp
 			}
@@ -0,0 +1,444 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"sort"
+	"sync"
+)
+
+// Joint decoding searches one strand for all reads of a cluster at once. A
+// hypothesis only branches on the next base of the strand; for every read it
+// keeps a band of the edit distance between its strand prefix and each read
+// prefix at most EDmax longer or shorter, so every alignment of every read is
+// tracked without branching on it. The penalty is the sum over reads of the
+// best distance in the band, and the distance to the whole read at the end.
+const JointMaxReads = 10
+
+// Band entry k of a hypothesis at depth d belongs to the read prefix of
+// length d - EDmax + k; entries past EDmax are clipped to EDmax + 1.
+func BandWidth(EDmax int) int {
+	return 2*EDmax + 1
+}
+
+func RootBands(readnum int, EDmax int) []int8 {
+	w := BandWidth(EDmax)
+	bands := make([]int8, readnum*w)
+	for r := 0; r < readnum; r++ {
+		for k := 0; k < w; k++ {
+			j := k - EDmax
+			if j < 0 {
+				bands[r*w+k] = int8(EDmax + 1)
+			} else {
+				bands[r*w+k] = int8(j)
+			}
+		}
+	}
+	return bands
+}
+
+// StepBands extends the strand prefix at depth by base c and returns the new
+// bands and the penalty; ok is false once a read is more than EDmax away.
+func StepBands(bands []int8, c rune, reads [][]rune, depth int, EDmax int, final bool) ([]int8, int, bool) {
+	w := BandWidth(EDmax)
+	inf := EDmax + 1
+	res := make([]int8, len(bands))
+	penalty := 0
+	for r := 0; r < len(reads); r++ {
+		old := bands[r*w : (r+1)*w]
+		band := res[r*w : (r+1)*w]
+		best := inf
+		for k := 0; k < w; k++ {
+			j := depth + 1 - EDmax + k
+			val := inf
+			if j >= 0 && j <= len(reads[r]) {
+				if j >= 1 {
+					cost := 0
+					if reads[r][j-1] != c {
+						cost = 1
+					}
+					val = min(val, int(old[k])+cost)
+				}
+				if k+1 < w {
+					val = min(val, int(old[k+1])+1)
+				}
+				if k > 0 {
+					val = min(val, int(band[k-1])+1)
+				}
+			}
+			val = min(val, inf)
+			band[k] = int8(val)
+			best = min(best, val)
+		}
+		if final {
+			k := len(reads[r]) - (depth + 1 - EDmax)
+			best = inf
+			if k >= 0 && k < w {
+				best = int(band[k])
+			}
+		}
+		if best > EDmax {
+			return nil, 0, false
+		}
+		penalty += best
+	}
+	return res, penalty, true
+}
+
+// PenaltyBound is the largest penalty kept when more than Maxhypo hypotheses
+// are left; counts[p] is the number of hypotheses with penalty p.
+func PenaltyBound(counts []int, Maxhypo int) int {
+	count := 0
+	for k := 0; k < len(counts); k++ {
+		count += counts[k]
+		if count > Maxhypo {
+			if k == 0 {
+				return 0
+			}
+			return k - 1
+		}
+	}
+	return len(counts) - 1
+}
+
+// JointCost is the ReadCost of a cluster. Joint decoding counts every edit as
+// one, so it only carries the stats of the search.
+func JointCost(stats *SearchStats) ReadCost {
+	return ReadCost{Unit: 1, Stats: stats}
+}
+
+func JointReads(cluster []string) [][]rune {
+	n := min(len(cluster), JointMaxReads)
+	reads := make([][]rune, n)
+	for r := 0; r < n; r++ {
+		reads[r] = []rune(cluster[r])
+	}
+	return reads
+}
+
+type JointHypothesis struct {
+	Hypothesis
+	Bands []int8
+}
+
+func (hypo *JointHypothesis) Addchild(reads [][]rune, cost ReadCost, data map[string]Kmer, EDmax int, params Params) []JointHypothesis {
+	res := make([]JointHypothesis, 0, 2)
+
+	previous := hypo.GenPrevious(params)
+	strandID := hypo.GenStrandID(params)
+	gc := hypo.GC(params)
+	depth := hypo.Depth(params)
+	pattern := hypo.Pattern(params)
+
+	potentialC := GenNextC(gc, depth-gc, Pattern2runes(pattern, params), previous, strandID, depth, data, params)
+
+	for i := 0; i < 2; i++ {
+		var child JointHypothesis
+
+		c_depth := depth + 1
+		c_gc := gc
+		ThisC := potentialC[i]
+		if ThisC == 'C' || ThisC == 'G' {
+			c_gc += 1
+		}
+		c_pattern := ((pattern << 2) + Nuc2Int(ThisC)) & params.PatternMask
+
+		bands, penalty, ok := StepBands(hypo.Bands, ThisC, reads, depth, EDmax, c_depth == params.MaxDepth)
+		if !ok {
+			continue
+		}
+
+		child.Bits = make([]int, params.Necessary_Decoding_Ints)
+		copy(child.Bits, hypo.Bits)
+		child.UpdateBits(i, c_depth)
+		child.Info = child.BuildInfo(c_pattern, c_gc, c_depth, 0, strandID, params)
+		child.Penalty = penalty
+		child.Bands = bands
+		if child.CheckHash(params) {
+			res = append(res, child)
+		} else {
+			cost.Stats.reject(c_depth)
+		}
+	}
+	return res
+}
+
+func Updateinfo_Joint(reads [][]rune, cost ReadCost, Maxhypo int, data map[string]Kmer, EDmax int, set *IDtobeDecode, params Params) (b Block, suc bool) {
+	start := cost.Stats.begin(cost, params)
+
+	hypotree_plist := make([]JointHypothesis, 0)
+	set.dataLock.Lock()
+	for i := 0; i < set.MaxID; i++ {
+		if !set.IDset[i] {
+			root := Genroothypo(data, i, params)
+			root.Info = root.BuildInfo(root.Pattern(params), 0, 0, 0, i, params)
+			hypotree_plist = append(hypotree_plist, JointHypothesis{Hypothesis: root, Bands: RootBands(len(reads), EDmax)})
+		}
+	}
+	set.dataLock.Unlock()
+
+	uppbound := len(reads)*EDmax + 2
+	for depth := 0; depth < params.MaxDepth && len(hypotree_plist) > 0; depth++ {
+		hypotree_qlist := make([]JointHypothesis, 0, 2*len(hypotree_plist))
+		for j := 0; j < len(hypotree_plist); j++ {
+			hypotree_qlist = append(hypotree_qlist, hypotree_plist[j].Addchild(reads, cost, data, EDmax, params)...)
+		}
+		cost.Stats.expand(len(hypotree_plist), len(hypotree_qlist))
+
+		if len(hypotree_qlist) > Maxhypo {
+			counts := make([]int, uppbound)
+			for k := 0; k < len(hypotree_qlist); k++ {
+				counts[hypotree_qlist[k].Penalty]++
+			}
+			maxpenal := PenaltyBound(counts, Maxhypo)
+			hypotree_plist = make([]JointHypothesis, 0)
+			for k := 0; k < len(hypotree_qlist); k++ {
+				if hypotree_qlist[k].Penalty <= maxpenal {
+					hypotree_plist = append(hypotree_plist, hypotree_qlist[k])
+				}
+			}
+		} else {
+			hypotree_plist = hypotree_qlist
+		}
+	}
+
+	sort.SliceStable(hypotree_plist, func(a, b int) bool {
+		return hypotree_plist[a].Penalty < hypotree_plist[b].Penalty
+	})
+
+	best := -1
+	penalties := make([]int, 0)
+	for i := 0; i < len(hypotree_plist); i++ {
+		if hypotree_plist[i].Depth(params) == params.MaxDepth {
+			if best < 0 {
+				best = i
+			}
+			penalties = append(penalties, hypotree_plist[i].Penalty)
+		}
+	}
+
+	if best >= 0 && cost.Judge(penalties, params) {
+		strandID := hypotree_plist[best].GenStrandID(params)
+		set.dataLock.Lock()
+		set.IDset[strandID] = true
+		set.dataLock.Unlock()
+		b = hypotree_plist[best].Traceback(params)
+		suc = true
+		cost.Stats.end(start, hypotree_plist[best].Penalty, suc)
+		return
+	}
+	cost.Stats.end(start, 0, suc)
+	return
+}
+
+type JointHypothesis_Three struct {
+	Hypothesis_Three
+	Bands []int8
+}
+
+func (hypo *JointHypothesis_Three) Addchild(reads [][]rune, cost ReadCost, EDmax int, params Params) []JointHypothesis_Three {
+	res := make([]JointHypothesis_Three, 0, 3)
+
+	gc := hypo.GC(params)
+	depth := hypo.Depth(params)
+	pattern := hypo.Pattern(params)
+	previous := hypo.GenPrevious(depth, params)
+	strandID := hypo.GenStrandID(params)
+	temp_previous := hypo.TempPrevious()
+
+	potentialC := GenNextC_Three(gc, depth-gc, Pattern2runes(pattern, params), previous, strandID, depth, params)
+
+	for i := 0; i < 3; i++ {
+		var child JointHypothesis_Three
+
+		c_depth := depth + 1
+		c_gc := gc
+		ThisC := potentialC[i]
+		if ThisC == 'C' || ThisC == 'G' {
+			c_gc += 1
+		}
+		c_pattern := ((pattern << 2) + Nuc2Int(ThisC)) & params.PatternMask
+		c_temp_previous := ((temp_previous << 2) + i) & Uint14Mask
+
+		bands, penalty, ok := StepBands(hypo.Bands, ThisC, reads, depth, EDmax, c_depth == params.MaxDepth)
+		if !ok {
+			continue
+		}
+
+		child.Bits = make([]int, params.Necessary_Decoding_Ints)
+		copy(child.Bits, hypo.Bits)
+
+		if c_depth%7 == 0 {
+			temp_bits, valid := TempPreviousToBits(c_temp_previous, 7)
+			if !valid {
+				continue
+			}
+			package_index := (c_depth / 7) - 1
+			for j := 0; j < 11; j++ {
+				child.UpdateBits(temp_bits[j], package_index*11+j)
+			}
+			c_temp_previous = 0
+		} else if c_depth == params.MaxDepth {
+			temp_bits, valid := TempPreviousToBits(c_temp_previous, params.Res3num)
+			if !valid {
+				continue
+			}
+			remainingBits := params.MaxBits % 11
+			if remainingBits == 0 && params.Res3num > 0 {
+				remainingBits = 11
+			}
+			if len(temp_bits) > remainingBits {
+				temp_bits = temp_bits[:remainingBits]
+			}
+			package_index := c_depth / 7
+			for j := 0; j < len(temp_bits); j++ {
+				child.UpdateBits(temp_bits[j], package_index*11+j)
+			}
+			c_temp_previous = 0
+		}
+
+		child.Info = child.BuildInfo(c_pattern, c_gc, c_depth, 0, strandID, params)
+		child.Penalty_Info = child.BuildPenaltyInfo(penalty, c_temp_previous, params)
+		child.Bands = bands
+		if child.CheckHash(params) {
+			res = append(res, child)
+		} else {
+			cost.Stats.reject(c_depth)
+		}
+	}
+	return res
+}
+
+func Updateinfo_Three_Joint(reads [][]rune, cost ReadCost, Maxhypo int, EDmax int, set *IDtobeDecode, params Params) (b Block, suc bool) {
+	start := cost.Stats.begin(cost, params)
+
+	hypotree_plist := make([]JointHypothesis_Three, 0)
+	set.dataLock.Lock()
+	for i := 0; i < set.MaxID; i++ {
+		if !set.IDset[i] {
+			root := Genroothypo_Three(i, params)
+			root.Info = root.BuildInfo(root.Pattern(params), 0, 0, 0, i, params)
+			hypotree_plist = append(hypotree_plist, JointHypothesis_Three{Hypothesis_Three: root, Bands: RootBands(len(reads), EDmax)})
+		}
+	}
+	set.dataLock.Unlock()
+
+	uppbound := len(reads)*EDmax + 2
+	for depth := 0; depth < params.MaxDepth && len(hypotree_plist) > 0; depth++ {
+		hypotree_qlist := make([]JointHypothesis_Three, 0, 3*len(hypotree_plist))
+		for j := 0; j < len(hypotree_plist); j++ {
+			hypotree_qlist = append(hypotree_qlist, hypotree_plist[j].Addchild(reads, cost, EDmax, params)...)
+		}
+		cost.Stats.expand(len(hypotree_plist), len(hypotree_qlist))
+
+		if len(hypotree_qlist) > Maxhypo {
+			counts := make([]int, uppbound)
+			for k := 0; k < len(hypotree_qlist); k++ {
+				counts[hypotree_qlist[k].Penalty()]++
+			}
+			maxpenal := PenaltyBound(counts, Maxhypo)
+			hypotree_plist = make([]JointHypothesis_Three, 0)
+			for k := 0; k < len(hypotree_qlist); k++ {
+				if hypotree_qlist[k].Penalty() <= maxpenal {
+					hypotree_plist = append(hypotree_plist, hypotree_qlist[k])
+				}
+			}
+		} else {
+			hypotree_plist = hypotree_qlist
+		}
+	}
+
+	sort.SliceStable(hypotree_plist, func(a, b int) bool {
+		return hypotree_plist[a].Penalty() < hypotree_plist[b].Penalty()
+	})
+
+	best := -1
+	penalties := make([]int, 0)
+	for i := 0; i < len(hypotree_plist); i++ {
+		if hypotree_plist[i].Depth(params) == params.MaxDepth {
+			if best < 0 {
+				best = i
+			}
+			penalties = append(penalties, hypotree_plist[i].Penalty())
+		}
+	}
+
+	if best >= 0 && cost.Judge(penalties, params) {
+		strandID := hypotree_plist[best].GenStrandID(params)
+		set.dataLock.Lock()
+		set.IDset[strandID] = true
+		set.dataLock.Unlock()
+		b = hypotree_plist[best].Traceback(params)
+		suc = true
+		cost.Stats.end(start, hypotree_plist[best].Penalty(), suc)
+		return
+	}
+	cost.Stats.end(start, 0, suc)
+	return
+}
+
+// Decode_Joint_Parallel decodes each cluster of reads of one strand as a whole,
+// following the search of cluster i in Stats[i] when Stats is not nil.
+func Decode_Joint_Parallel(Clusters [][]string, Stats []SearchStats, Maxhypo int, threads_num int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
+	var data map[string]Kmer
+	if params.Option != Gungnir_Trit_Params {
+		data = Profile()
+	}
+	blocknum := len(Clusters)
+	bit_stream := make([]Block, blocknum)
+	decode_res := make([]bool, blocknum)
+
+	var wg sync.WaitGroup
+	wg.Add(blocknum)
+
+	ch := make(chan struct{}, threads_num)
+
+	for i := 0; i < blocknum; i++ {
+
+		index := i
+		ch <- struct{}{}
+		go func() {
+
+			var temp Block
+			reads := JointReads(Clusters[index])
+			if params.Option != Gungnir_Trit_Params {
+				temp, decode_res[index] = Updateinfo_Joint(reads, JointCost(StatsAt(Stats, index)), Maxhypo, data, EDmax, set, params)
+			} else {
+				temp, decode_res[index] = Updateinfo_Three_Joint(reads, JointCost(StatsAt(Stats, index)), Maxhypo, EDmax, set, params)
+			}
+			if decode_res[index] {
+				bit_stream[index] = temp
+			}
+
+			<-ch
+			wg.Done()
+		}()
+
+	}
+
+	wg.Wait()
+	return bit_stream, decode_res
+}
@@ -101,7 +101,7 @@ type PlistShard_Three struct {
 
 func Genroothypo_Three(strandID int, params Params) Hypothesis_Three {
 	var hypo Hypothesis_Three
-	pattern := Runes2Pattern([]rune(InitPattern(params.PreviousNuc)), params)
+	pattern := Runes2Pattern([]rune(PrimerPattern(params.Primer, params.PreviousNuc)), params)
 	hypo.Penalty_Info = 0
 	hypo.Info = hypo.BuildInfo(pattern, 0, 0, Uint9Mask, strandID, params)
 	hypo.Bits = make([]int, params.Necessary_Decoding_Ints)
@@ -178,55 +178,43 @@ func (hypo *Hypothesis_Three) Selectbits(index int) int {
 }
 
 func (hypo *Hypothesis_Three) GenPrevious(depth int, params Params) []int {
-	bit_stream := make([]int, params.MaxBits)
-	bitnum := depth * 11 / 7
-	for i := 0; i < bitnum; i++ {
-		bit_stream[i] = hypo.Selectbits(i)
-	}
-	return GenPreviousSet(bit_stream, hypo.TempPrevious(), depth/7)
+	return GenPreviousSet(hypo.GenBits(0, depth*11/7), hypo.TempPrevious(), depth/7)
 }
 
-func (hypo *Hypothesis_Three) GenHash0(params Params) []int {
-	res := make([]int, params.HashLenSet[0])
-
-	for i := 0; i < len(res); i++ {
-		res[i] = hypo.Selectbits(i)
+// GenBits copies bits [start, end) out of the 55-bit packed Bits.
+func (hypo *Hypothesis_Three) GenBits(start, end int) Bitset {
+	res := NewBitset(end - start)
+	for i := start; i < end; i++ {
+		res.Set(i-start, hypo.Selectbits(i))
 	}
 	return res
 }
 
-func (hypo *Hypothesis_Three) GenHashIndex(hashindex int, params Params) []int {
-	res := make([]int, params.HashLenSet[hashindex])
+func (hypo *Hypothesis_Three) GenHash0(params Params) Bitset {
+	return hypo.GenBits(0, params.HashLenSet[0])
+}
+
+func (hypo *Hypothesis_Three) GenHashIndex(hashindex int, params Params) Bitset {
 	previousLen := params.HashLenSet[0]
 	for i := 1; i < hashindex; i++ {
 		previousLen += params.HashLenSet[i]
 		previousLen += params.PayloadLenSet[i]
 	}
 
-	for i := 0; i < len(res); i++ {
-		res[i] = hypo.Selectbits(previousLen + i)
-	}
-	return res
+	return hypo.GenBits(previousLen, previousLen+params.HashLenSet[hashindex])
 }
 
-func (hypo *Hypothesis_Three) GenPayload0(params Params) []int {
-	res := make([]int, params.PayloadLenSet[0])
-
+func (hypo *Hypothesis_Three) GenPayload0(params Params) Bitset {
 	previousLen := params.HashLenSet[0]
 	for i := 1; i < len(params.PayloadLenSet); i++ {
 		previousLen += params.HashLenSet[i]
 		previousLen += params.PayloadLenSet[i]
 	}
 
-	for i := 0; i < len(res); i++ {
-		res[i] = hypo.Selectbits(previousLen + i)
-	}
-	return res
+	return hypo.GenBits(previousLen, previousLen+params.PayloadLenSet[0])
 }
 
-func (hypo *Hypothesis_Three) GenPayloadIndex(payloadindex int, params Params) []int {
-	res := make([]int, params.PayloadLenSet[payloadindex])
-
+func (hypo *Hypothesis_Three) GenPayloadIndex(payloadindex int, params Params) Bitset {
 	previousLen := params.HashLenSet[0]
 	for i := 1; i < payloadindex; i++ {
 		previousLen += params.HashLenSet[i]
@@ -234,14 +222,11 @@ func (hypo *Hypothesis_Three) GenPayloadIndex(payloadindex int, params Params) [
 	}
 	previousLen += params.HashLenSet[payloadindex]
 
-	for i := 0; i < len(res); i++ {
-		res[i] = hypo.Selectbits(previousLen + i)
-	}
-	return res
+	return hypo.GenBits(previousLen, previousLen+params.PayloadLenSet[payloadindex])
 }
 
-func (hypo *Hypothesis_Three) GenPayload(params Params) [][]int {
-	res := make([][]int, len(params.PayloadLenSet))
+func (hypo *Hypothesis_Three) GenPayload(params Params) []Bitset {
+	res := make([]Bitset, len(params.PayloadLenSet))
 
 	res[0] = hypo.GenPayload0(params)
 
@@ -279,7 +264,7 @@ func (hypo *Hypothesis_Three) CheckHash0(params Params) bool {
 	return true
 }
 
-func (hypo *Hypothesis_Three) Addchild(DataC []rune, EDmax int, params Params) []Hypothesis_Three {
+func (hypo *Hypothesis_Three) Addchild(DataC []rune, cost ReadCost, EDmax int, params Params) []Hypothesis_Three {
 	res := make([]Hypothesis_Three, 0)
 	if hypo.Depth(params) == params.MaxDepth {
 		return []Hypothesis_Three{*hypo}
@@ -328,11 +313,11 @@ func (hypo *Hypothesis_Three) Addchild(DataC []rune, EDmax int, params Params) [
 		x_temp_previous = x_temp_previous & Uint14Mask
 
 		if ThisC != DataC[x_index] {
-			x_penalty += 1
+			x_penalty += cost.Base[x_index]
 		}
 
 		if x_depth == params.MaxDepth {
-			x_penalty += (len(DataC) - 1 - x_index)
+			x_penalty += cost.Tail(x_index+1, params)
 			x_index = len(DataC) - 1
 		}
 
@@ -369,8 +354,12 @@ func (hypo *Hypothesis_Three) Addchild(DataC []rune, EDmax int, params Params) [
 
 		childX.Penalty_Info = childX.BuildPenaltyInfo(x_penalty, x_temp_previous, params)
 
-		if x_penalty < EDmax+1 && childX.CheckHash(params) {
-			res = append(res, childX)
+		if x_penalty < cost.Bound(EDmax) {
+			if childX.CheckHash(params) {
+				res = append(res, childX)
+			} else {
+				cost.Stats.reject(x_depth)
+			}
 		}
 	}
 
@@ -391,7 +380,7 @@ func (hypo *Hypothesis_Three) Addchild(DataC []rune, EDmax int, params Params) [
 
 		d_pattern := ((pattern << 2) + Nuc2Int(ThisC)) & params.PatternMask
 
-		d_penalty := penalty + 1
+		d_penalty := penalty + cost.Unit
 		d_temp_previous := temp_previous << 2
 		d_temp_previous += i
 		d_temp_previous = d_temp_previous & Uint14Mask
@@ -401,7 +390,7 @@ func (hypo *Hypothesis_Three) Addchild(DataC []rune, EDmax int, params Params) [
 		}
 
 		if d_depth == params.MaxDepth {
-			d_penalty += len(DataC) - 1 - d_index
+			d_penalty += cost.Tail((d_index+1)&Uint9Mask, params)
 			d_index = len(DataC) - 1
 		}
 
@@ -439,8 +428,12 @@ func (hypo *Hypothesis_Three) Addchild(DataC []rune, EDmax int, params Params) [
 
 		childD.Penalty_Info = childD.BuildPenaltyInfo(d_penalty, d_temp_previous, params)
 
-		if d_penalty < EDmax+1 && childD.CheckHash(params) {
-			res = append(res, childD)
+		if d_penalty < cost.Bound(EDmax) {
+			if childD.CheckHash(params) {
+				res = append(res, childD)
+			} else {
+				cost.Stats.reject(d_depth)
+			}
 		}
 	}
 
@@ -455,10 +448,13 @@ func (hypo *Hypothesis_Three) Addchild(DataC []rune, EDmax int, params Params) [
 			childI.Bits[i] = hypo.Bits[i]
 		}
 
-		childI.Penalty_Info = hypo.Penalty_Info + 1
+		childI.Penalty_Info = hypo.Penalty_Info + cost.Base[i_index&Uint9Mask]
+		if params.LeadFree(depth, i_index&Uint9Mask) {
+			childI.Penalty_Info = hypo.Penalty_Info
+		}
 
 		childI.Info = childI.BuildInfo(pattern, gc, depth, i_index, strandID, params)
-		if childI.Penalty() < EDmax+1 {
+		if childI.Penalty() < cost.Bound(EDmax) {
 			res = append(res, childI)
 		}
 	}
@@ -472,7 +468,7 @@ func (hypo *Hypothesis_Three) Traceback(params Params) (b Block) {
 	}
 	b.BlockID = hypo.GenStrandID(params)
 	b.Payload = hypo.GenPayload(params)
-	b.Hash = make([][]int, len(params.HashLenSet))
+	b.Hash = make([]Bitset, len(params.HashLenSet))
 	b.Hash[0] = hypo.GenHash0(params)
 	for i := 1; i < len(b.Hash); i++ {
 		b.Hash[i] = hypo.GenHashIndex(i, params)
@@ -481,7 +477,8 @@ func (hypo *Hypothesis_Three) Traceback(params Params) (b Block) {
 	return
 }
 
-func Updateinfo_Three_Multithread(consensus []rune, Maxhypo int, threads_num int, EDmax int, set *IDtobeDecode, params Params) (b Block, suc bool) {
+func Updateinfo_Three_Multithread(consensus []rune, cost ReadCost, Maxhypo int, threads_num int, EDmax int, set *IDtobeDecode, params Params) (b Block, suc bool) {
+	start := cost.Stats.begin(cost, params)
 	var hypotree_plist PlistWithLock_Three
 	hypotree_plist.Init(set, params)
 
@@ -505,7 +502,7 @@ func Updateinfo_Three_Multithread(consensus []rune, Maxhypo int, threads_num int
 				this_hypo := make([]Hypothesis_Three, 0)
 
 				for k := 0; k < num_thistask; k++ {
-					temp := hypotree_plist.shards[index].hypos[k].Addchild(consensus, EDmax, params)
+					temp := hypotree_plist.shards[index].hypos[k].Addchild(consensus, cost, EDmax, params)
 					if temp != nil {
 						this_hypo = append(this_hypo, temp...)
 					}
@@ -541,7 +538,9 @@ func Updateinfo_Three_Multithread(consensus []rune, Maxhypo int, threads_num int
 
 		wg.Wait()
 
+		task := 0
 		for j := 0; j < hypotree_plist.shardCount; j++ {
+			task += len(hypotree_plist.shards[j].hypos)
 			hypotree_plist.shards[j].hypos = nil
 		}
 
@@ -549,10 +548,11 @@ func Updateinfo_Three_Multithread(consensus []rune, Maxhypo int, threads_num int
 		for k := 0; k < hypotree_qlist.shardCount; k++ {
 			totalvalidnum += hypotree_qlist.shards[k].valid_num
 		}
+		cost.Stats.expand(task, totalvalidnum)
 
 		if totalvalidnum > Maxhypo {
 
-			uppbound := EDmax + 2
+			uppbound := cost.Bound(EDmax) + 1
 			sumlist := make([]int, uppbound)
 			for k := 0; k < uppbound; k++ {
 				sumlist[k] = 0
@@ -666,22 +666,34 @@ func Updateinfo_Three_Multithread(consensus []rune, Maxhypo int, threads_num int
 
 	suc = false
 
+	best := -1
+	penalties := make([]int, 0)
 	for i := 0; i < len(final_hypos); i++ {
 		if final_hypos[i].Depth(params) == params.MaxDepth {
-			strandID := final_hypos[i].GenStrandID(params)
-			set.dataLock.Lock()
-			set.IDset[strandID] = true
-			set.dataLock.Unlock()
-			b = final_hypos[i].Traceback(params)
-			suc = true
-			return
+			if best < 0 {
+				best = i
+			}
+			penalties = append(penalties, final_hypos[i].Penalty())
 		}
 	}
 
+	if best >= 0 && cost.Judge(penalties, params) {
+		strandID := final_hypos[best].GenStrandID(params)
+		set.dataLock.Lock()
+		set.IDset[strandID] = true
+		set.dataLock.Unlock()
+		b = final_hypos[best].Traceback(params)
+		suc = true
+		cost.Stats.end(start, final_hypos[best].Penalty(), suc)
+		return
+	}
+
+	cost.Stats.end(start, 0, suc)
 	return
 }
 
-func Updateinfo_Three_Singlethread(consensus []rune, Maxhypo int, EDmax int, set *IDtobeDecode, params Params) (b Block, suc bool) {
+func Updateinfo_Three_Singlethread(consensus []rune, cost ReadCost, Maxhypo int, EDmax int, set *IDtobeDecode, params Params) (b Block, suc bool) {
+	start := cost.Stats.begin(cost, params)
 
 	hypotree_plist := make([]Hypothesis_Three, 0)
 	set.dataLock.Lock()
@@ -703,7 +715,7 @@ func Updateinfo_Three_Singlethread(consensus []rune, Maxhypo int, EDmax int, set
 		task := len(hypotree_plist)
 
 		for j := 0; j < task; j++ {
-			temp := hypotree_plist[j].Addchild(consensus, EDmax, params)
+			temp := hypotree_plist[j].Addchild(consensus, cost, EDmax, params)
 			if temp != nil {
 				for k := 0; k < len(temp); k++ {
 					key := temp[k].CalKey(params)
@@ -721,11 +733,12 @@ func Updateinfo_Three_Singlethread(consensus []rune, Maxhypo int, EDmax int, set
 
 		}
 
+		cost.Stats.expand(task, hypotree_qlist.valid_num)
 		hypotree_plist = nil
 
 		if hypotree_qlist.valid_num > Maxhypo {
 
-			uppbound := EDmax + 2
+			uppbound := cost.Bound(EDmax) + 1
 			sumlist := make([]int, uppbound)
 			for k := 0; k < uppbound; k++ {
 				sumlist[k] = 0
@@ -780,29 +793,40 @@ func Updateinfo_Three_Singlethread(consensus []rune, Maxhypo int, EDmax int, set
 
 	suc = false
 
+	best := -1
+	penalties := make([]int, 0)
 	for i := 0; i < len(hypotree_plist); i++ {
 		if hypotree_plist[i].Depth(params) == params.MaxDepth {
-			strandID := hypotree_plist[i].GenStrandID(params)
-			set.dataLock.Lock()
-			set.IDset[strandID] = true
-			set.dataLock.Unlock()
-			b = hypotree_plist[i].Traceback(params)
-			suc = true
-			return
+			if best < 0 {
+				best = i
+			}
+			penalties = append(penalties, hypotree_plist[i].Penalty())
 		}
 	}
 
+	if best >= 0 && cost.Judge(penalties, params) {
+		strandID := hypotree_plist[best].GenStrandID(params)
+		set.dataLock.Lock()
+		set.IDset[strandID] = true
+		set.dataLock.Unlock()
+		b = hypotree_plist[best].Traceback(params)
+		suc = true
+		cost.Stats.end(start, hypotree_plist[best].Penalty(), suc)
+		return
+	}
+
+	cost.Stats.end(start, 0, suc)
 	return
 }
 
-func Decode_Three_Multithread(Consensus []string, Maxhypo int, threads_num int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
+func Decode_Three_Multithread(Consensus []string, Quals [][]int, Stats []SearchStats, Maxhypo int, threads_num int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
 	blocknum := len(Consensus)
 	bit_stream := make([]Block, blocknum)
 	decode_res := make([]bool, blocknum)
 
 	for i := 0; i < blocknum; i++ {
 		var temp Block
-		temp, decode_res[i] = Updateinfo_Three_Multithread([]rune(Consensus[i]), Maxhypo, threads_num, EDmax, set, params)
+		temp, decode_res[i] = Updateinfo_Three_Multithread([]rune(Consensus[i]), CostAt(Consensus, Quals, Stats, i, params), Maxhypo, threads_num, EDmax, set, params)
 		if decode_res[i] {
 			bit_stream[i] = temp
 		}
@@ -811,7 +835,7 @@ func Decode_Three_Multithread(Consensus []string, Maxhypo int, threads_num int,
 	return bit_stream, decode_res
 }
 
-func Decode_Three_Parallel(Consensus []string, Maxhypo int, threads_num int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
+func Decode_Three_Parallel(Consensus []string, Quals [][]int, Stats []SearchStats, Maxhypo int, threads_num int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
 	blocknum := len(Consensus)
 	bit_stream := make([]Block, blocknum)
 	decode_res := make([]bool, blocknum)
@@ -828,7 +852,7 @@ func Decode_Three_Parallel(Consensus []string, Maxhypo int, threads_num int, EDm
 		go func() {
 
 			var temp Block
-			temp, decode_res[index] = Updateinfo_Three_Singlethread([]rune(Consensus[index]), Maxhypo, EDmax, set, params)
+			temp, decode_res[index] = Updateinfo_Three_Singlethread([]rune(Consensus[index]), CostAt(Consensus, Quals, Stats, index, params), Maxhypo, EDmax, set, params)
 			if decode_res[index] {
 				bit_stream[index] = temp
 			}
@@ -843,7 +867,7 @@ func Decode_Three_Parallel(Consensus []string, Maxhypo int, threads_num int, EDm
 	return bit_stream, decode_res
 }
 
-func Decode_Three_Mix(Consensus []string, Maxhypo int, threads_num1 int, threads_num2 int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
+func Decode_Three_Mix(Consensus []string, Quals [][]int, Stats []SearchStats, Maxhypo int, threads_num1 int, threads_num2 int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
 	blocknum := len(Consensus)
 	bit_stream := make([]Block, blocknum)
 	decode_res := make([]bool, blocknum)
@@ -860,7 +884,7 @@ func Decode_Three_Mix(Consensus []string, Maxhypo int, threads_num1 int, threads
 		go func() {
 
 			var temp Block
-			temp, decode_res[index] = Updateinfo_Three_Multithread([]rune(Consensus[index]), Maxhypo, threads_num2, EDmax, set, params)
+			temp, decode_res[index] = Updateinfo_Three_Multithread([]rune(Consensus[index]), CostAt(Consensus, Quals, Stats, index, params), Maxhypo, threads_num2, EDmax, set, params)
 			if decode_res[index] {
 				bit_stream[index] = temp
 			}
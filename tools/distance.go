@@ -26,7 +26,18 @@
 
 package tools
 
-func EditingDistance(s1, s2 string) (int, int, int, int) {
+// Edit operations of EditScript: s1 is the reference, s2 the read.
+const (
+	EditMatch = 'M'
+	EditSub   = 'X'
+	EditIns   = 'I'
+	EditDel   = 'D'
+)
+
+// EditScript gives the edit distance from s1 to s2 and the edits of one
+// shortest alignment, in order. An insertion adds a base of s2, a deletion
+// drops a base of s1.
+func EditScript(s1, s2 string) (int, []byte) {
 	m, n := len(s1), len(s2)
 
 	dp := make([][]int, m+1)
@@ -56,26 +67,46 @@ func EditingDistance(s1, s2 string) (int, int, int, int) {
 	}
 
 	i, j := m, n
-	substitutions, insertions, deletions := 0, 0, 0
+	ops := make([]byte, 0, max(m, n))
 
 	for i > 0 || j > 0 {
 		if i > 0 && j > 0 && s1[i-1] == s2[j-1] {
+			ops = append(ops, EditMatch)
 			i--
 			j--
 		} else if i > 0 && j > 0 && dp[i][j] == dp[i-1][j-1]+1 {
-			substitutions++
+			ops = append(ops, EditSub)
 			i--
 			j--
 		} else if j > 0 && dp[i][j] == dp[i][j-1]+1 {
-			insertions++
+			ops = append(ops, EditIns)
 			j--
 		} else {
-			deletions++
+			ops = append(ops, EditDel)
 			i--
 		}
 	}
+	for a, b := 0, len(ops)-1; a < b; a, b = a+1, b-1 {
+		ops[a], ops[b] = ops[b], ops[a]
+	}
+
+	return dp[m][n], ops
+}
 
-	return dp[m][n], substitutions, insertions, deletions
+func EditingDistance(s1, s2 string) (int, int, int, int) {
+	dist, ops := EditScript(s1, s2)
+	substitutions, insertions, deletions := 0, 0, 0
+	for _, op := range ops {
+		switch op {
+		case EditSub:
+			substitutions++
+		case EditIns:
+			insertions++
+		case EditDel:
+			deletions++
+		}
+	}
+	return dist, substitutions, insertions, deletions
 }
 
 func Hamming_Distrance(dna1, dna2 []rune) int {
@@ -27,62 +27,63 @@ package tools
 
 import (
 	"fmt"
-	"log"
 	"sort"
 )
 
 type Block struct {
 	BlockID int
-	Hash    [][]int
-	Payload [][]int
+	Hash    []Bitset
+	Payload []Bitset
 }
 
-func BitsintoBlocks(bits []int, params Params) []Block {
-	BlockNum := (len(bits) + params.PayloadLen - 1) / params.PayloadLen
-	newbits := make([]int, params.PayloadLen*BlockNum)
-	for i := 0; i < len(newbits); i++ {
-		if i < len(bits) {
-			newbits[i] = bits[i]
-		} else {
-			newbits[i] = 0
-		}
-	}
+func BitsintoBlocks(bits Bitset, params Params) []Block {
+	BlockNum := (bits.Len() + params.PayloadLen - 1) / params.PayloadLen
+	newbits := bits.Slice(0, bits.Len())
+	newbits.Grow(params.PayloadLen * BlockNum)
 
 	Data := make([]Block, BlockNum)
 	for i := 0; i < BlockNum; i++ {
-		bits_temp := newbits[i*params.PayloadLen : (i+1)*params.PayloadLen]
-		Data[i].BlockID = i
-		Data[i].Payload = make([][]int, len(params.PayloadLenSet))
-		sum := 0
-		for j := 0; j < len(params.PayloadLenSet); j++ {
-			Data[i].Payload[j] = bits_temp[sum : sum+params.PayloadLenSet[j]]
-			sum += params.PayloadLenSet[j]
-		}
+		bits_temp := newbits.Slice(i*params.PayloadLen, (i+1)*params.PayloadLen)
+		Data[i] = GenBlock(i, bits_temp, params)
+	}
+	return Data
+}
 
-		Data[i].Hash = make([][]int, len(params.HashLenSet))
-		Data[i].Hash[0] = Hash0Payload(Data[i].BlockID, bits_temp, params)
+// bits_temp holds exactly params.PayloadLen bits
+func GenBlock(blockID int, bits_temp Bitset, params Params) Block {
+	var b Block
+	b.BlockID = blockID
+	b.Payload = make([]Bitset, len(params.PayloadLenSet))
+	sum := 0
+	for j := 0; j < len(params.PayloadLenSet); j++ {
+		b.Payload[j] = bits_temp.Slice(sum, sum+params.PayloadLenSet[j])
+		sum += params.PayloadLenSet[j]
+	}
 
-		for j := 1; j < len(params.HashLenSet); j++ {
-			Data[i].Hash[j] = HashIndex(Data[i].BlockID, Data[i].Payload[j], Data[i].Hash[0], j, params)
-		}
+	b.Hash = make([]Bitset, len(params.HashLenSet))
+	b.Hash[0] = Hash0Payload(b.BlockID, bits_temp, params)
 
+	for j := 1; j < len(params.HashLenSet); j++ {
+		b.Hash[j] = HashIndex(b.BlockID, b.Payload[j], b.Hash[0], j, params)
 	}
-	return Data
+	return b
 }
 
-func BlocksintoBits(Data []Block, params Params) (bits []int) {
-	bits = make([]int, len(Data)*params.PayloadLen)
+func BlocksintoBits(Data []Block, params Params) Bitset {
+	bits := NewBitset(0)
 	for i := 0; i < len(Data); i++ {
-		temp_payload := ReshapePayload(Data[i].Payload, params)
-		for j := 0; j < params.PayloadLen; j++ {
-			bits[i*params.PayloadLen+j] = temp_payload[j]
-		}
+		bits.Append(ReshapePayload(Data[i].Payload, params))
 	}
-	return
+	return bits
 }
 
 func InitPattern(p int) string {
-	temp := []rune(Primer)
+	return PrimerPattern(Primer, p)
+}
+
+// PrimerPattern is the last p bases of the primer, which precede the first base of a strand.
+func PrimerPattern(primer string, p int) string {
+	temp := []rune(primer)
 	res := temp[len(temp)-p:]
 	return string(res)
 }
@@ -440,7 +441,7 @@ func UpdateBalance(balanceC []rune, kmerPre []rune, previous int, blockID int, i
 }
 
 func Block2DNA(input Block, data map[string]Kmer, params Params) string {
-	Pattern := []rune(InitPattern(params.PreviousNuc))
+	Pattern := []rune(PrimerPattern(params.Primer, params.PreviousNuc))
 	runes := make([]rune, params.MaxDepth)
 	previous := 0
 	gc := 0
@@ -451,7 +452,7 @@ func Block2DNA(input Block, data map[string]Kmer, params Params) string {
 		if len(input.Hash) == 0 {
 			bit = 0
 		} else {
-			bit = input.Hash[0][i]
+			bit = input.Hash[0].Get(i)
 		}
 		thisC := GenNextC(gc, at, Pattern, previous, input.BlockID, index, data, params)[bit]
 		if thisC == 'G' || thisC == 'C' {
@@ -471,7 +472,7 @@ func Block2DNA(input Block, data map[string]Kmer, params Params) string {
 			if len(input.Hash) == 0 {
 				bit = 0
 			} else {
-				bit = input.Hash[k][i]
+				bit = input.Hash[k].Get(i)
 			}
 			thisC := GenNextC(gc, at, Pattern, previous, input.BlockID, index, data, params)[bit]
 			if thisC == 'G' || thisC == 'C' {
@@ -489,7 +490,7 @@ func Block2DNA(input Block, data map[string]Kmer, params Params) string {
 			if len(input.Payload) == 0 {
 				bit = 0
 			} else {
-				bit = input.Payload[k][i]
+				bit = input.Payload[k].Get(i)
 			}
 			thisC := GenNextC(gc, at, Pattern, previous, input.BlockID, index, data, params)[bit]
 			if thisC == 'G' || thisC == 'C' {
@@ -509,7 +510,7 @@ func Block2DNA(input Block, data map[string]Kmer, params Params) string {
 		if len(input.Payload) == 0 {
 			bit = 0
 		} else {
-			bit = input.Payload[0][i]
+			bit = input.Payload[0].Get(i)
 		}
 		thisC := GenNextC(gc, at, Pattern, previous, input.BlockID, index, data, params)[bit]
 		if thisC == 'G' || thisC == 'C' {
@@ -526,27 +527,27 @@ func Block2DNA(input Block, data map[string]Kmer, params Params) string {
 	return string(runes)
 }
 
-func Gen3Slice(bitstream []int) []int {
-	if len(bitstream) > 11 {
-		log.Fatal("Invalid Bitstream Length!")
-	}
-	sum := 0
-	for i := 0; i < len(bitstream); i++ {
-		sum += (bitstream[i] << i)
+// Gen3Slice writes at most 11 bits as 7 trits, lowest first.
+func Gen3Slice(bitstream Bitset) ([]int, error) {
+	if bitstream.Len() > 11 {
+		return nil, &LengthError{What: "bitstream", Got: bitstream.Len(), Want: 11, AtMost: true}
 	}
+	sum := int(bitstream.Uint(0, bitstream.Len()))
 	res := make([]int, 7)
 	for i := 0; i < 7; i++ {
 		res[i] = sum % 3
 		sum = sum / 3
 	}
 
-	return res
+	return res, nil
 }
 
+// RecoverBitsFrom3Slice reads back the 11 bits of at most 7 trits, false
+// when the trits hold more.
 func RecoverBitsFrom3Slice(threestream []int) ([]int, bool) {
 	res := make([]int, 11)
 	if len(threestream) > 7 {
-		log.Fatal("Invalid Threestream Length!")
+		return res, false
 	}
 	sum := 0
 	temp := 1
@@ -565,48 +566,20 @@ func RecoverBitsFrom3Slice(threestream []int) ([]int, bool) {
 	return res, true
 }
 
-func BlockBits(input Block, params Params) []int {
-	res := make([]int, 0)
-	for i := 0; i < params.HashLenSet[0]; i++ {
-		var bit int
-		if len(input.Hash) == 0 {
-			bit = 0
-		} else {
-			bit = input.Hash[0][i]
-		}
-		res = append(res, bit)
+func BlockBits(input Block, params Params) Bitset {
+	res := NewBitset(0)
+	if len(input.Hash) == 0 {
+		res.Grow(params.HashLen + params.PayloadLen)
+		return res
 	}
+	res.Append(input.Hash[0])
 
 	for k := 1; k < len(params.HashLenSet); k++ {
-		for i := 0; i < params.HashLenSet[k]; i++ {
-			var bit int
-			if len(input.Hash) == 0 {
-				bit = 0
-			} else {
-				bit = input.Hash[k][i]
-			}
-			res = append(res, bit)
-		}
-		for i := 0; i < params.PayloadLenSet[k]; i++ {
-			var bit int
-			if len(input.Payload) == 0 {
-				bit = 0
-			} else {
-				bit = input.Payload[k][i]
-			}
-			res = append(res, bit)
-		}
+		res.Append(input.Hash[k])
+		res.Append(input.Payload[k])
 	}
 
-	for i := 0; i < params.PayloadLenSet[0]; i++ {
-		var bit int
-		if len(input.Payload) == 0 {
-			bit = 0
-		} else {
-			bit = input.Payload[0][i]
-		}
-		res = append(res, bit)
-	}
+	res.Append(input.Payload[0])
 
 	return res
 }
@@ -621,33 +594,33 @@ func BitsToInt(bits []int) int {
 
 // 55 + 22 + this package (11 bits to 14 bits): 88 bits (represented as 91 bits)
 // previous 0: bits in temp_previous -> 14 bits + 22 previous bits;
-func GenPreviousSet(bitstream []int, temp_previous int, i int) []int {
+func GenPreviousSet(bitstream Bitset, temp_previous int, i int) []int {
 	if i < 3 {
 		previous := make([]int, 1)
-		previous[0] = BitsToInt(bitstream[:11*i])
+		previous[0] = int(bitstream.Uint(0, 11*i))
 		previous[0] = previous[0] << 14
 		previous[0] += temp_previous
 		return previous
 	} else if i < 8 {
 		previous := make([]int, 2)
-		previous[0] = BitsToInt(bitstream[11*(i-2) : 11*i])
+		previous[0] = int(bitstream.Uint(11*(i-2), 11*i))
 		previous[0] = previous[0] << 14
 		previous[0] += temp_previous
-		previous[1] = BitsToInt(bitstream[0 : 11*(i-2)])
+		previous[1] = int(bitstream.Uint(0, 11*(i-2)))
 		return previous
 	} else {
 		previous := make([]int, 2)
-		previous[0] = BitsToInt(bitstream[11*(i-2) : 11*i])
+		previous[0] = int(bitstream.Uint(11*(i-2), 11*i))
 		previous[0] = previous[0] << 14
 		previous[0] += temp_previous
-		previous[1] = BitsToInt(bitstream[11*(i-7) : 11*(i-2)])
+		previous[1] = int(bitstream.Uint(11*(i-7), 11*(i-2)))
 		return previous
 	}
 }
 
-func Block2DNA_Three(input Block, params Params) string {
+func Block2DNA_Three(input Block, params Params) (string, error) {
 	bitstream := BlockBits(input, params)
-	Pattern := []rune(InitPattern(params.PreviousNuc))
+	Pattern := []rune(PrimerPattern(params.Primer, params.PreviousNuc))
 	runes := make([]rune, params.MaxDepth)
 	gc := 0
 	at := 0
@@ -672,7 +645,11 @@ func Block2DNA_Three(input Block, params Params) string {
 		// fmt.Println(bitstream[i*11:maxbound], params)
 		// fmt.Println(Gen3Slice(bitstream[i*11:maxbound], params), len(threeset[i]))
 		// fmt.Println(i, len(threeset[i]))
-		threeset[i] = Gen3Slice(bitstream[i*11 : maxbound])[:len(threeset[i])]
+		threes, err := Gen3Slice(bitstream.Slice(i*11, maxbound))
+		if err != nil {
+			return "", err
+		}
+		threeset[i] = threes[:len(threeset[i])]
 	}
 
 	// fmt.Println(threeset)
@@ -704,7 +681,7 @@ func Block2DNA_Three(input Block, params Params) string {
 		}
 	}
 
-	return string(runes)
+	return string(runes), nil
 }
 
 func TempPreviousToBits(temp_previous int, max_threenum int) ([]int, bool) {
@@ -720,20 +697,24 @@ func TempPreviousToBits(temp_previous int, max_threenum int) ([]int, bool) {
 	return RecoverBitsFrom3Slice(threes)
 }
 
-func Encode(Data []Block, params Params) []string {
-	data, _ := Readjson()
+func Encode(Data []Block, params Params) ([]string, error) {
+	data := Profile()
 	blocknum := len(Data)
 	dna := make([]string, blocknum)
 	if params.Option == Gungnir_Trit_Params {
 		for i := 0; i < blocknum; i++ {
-			dna[i] = Block2DNA_Three(Data[i], params)
+			var err error
+			dna[i], err = Block2DNA_Three(Data[i], params)
+			if err != nil {
+				return nil, err
+			}
 		}
-		return dna
+		return dna, nil
 	}
 	for i := 0; i < blocknum; i++ {
 		dna[i] = Block2DNA(Data[i], data, params)
 	}
-	return dna
+	return dna, nil
 }
 
 // for random error generation
@@ -777,6 +758,8 @@ func GenRevString(s string) string {
 			res[i] = 'G'
 		} else if temp[len(temp)-1-i] == 'G' {
 			res[i] = 'C'
+		} else {
+			res[i] = temp[len(temp)-1-i]
 		}
 
 	}
@@ -822,7 +805,11 @@ func calerrorrate_site(index int, str []rune, dataset []map[string]Kmer) float64
 }
 
 func Calexpecterror(dna []string) {
-	_, dataset, ee := ReadjsonAll()
+	_, dataset, ee, err := ReadjsonAll()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	sim_e := 0.0
 	count := 0
 	pattern := InitPattern(KmerSize - 1)
@@ -842,9 +829,12 @@ func Calexpecterror(dna []string) {
 
 }
 
-func CalError(dna []string) []float64 {
+func CalError(dna []string) ([]float64, error) {
 	res := make([]float64, len(dna))
-	_, dataset, _ := ReadjsonAll()
+	_, dataset, _, err := ReadjsonAll()
+	if err != nil {
+		return nil, err
+	}
 	pattern := InitPattern(KmerSize - 1)
 	for i := 0; i < len(dna); i++ {
 		str := pattern + dna[i]
@@ -855,5 +845,5 @@ func CalError(dna []string) []float64 {
 		}
 		res[i] = res[i] / float64(len(dna[i]))
 	}
-	return res
+	return res, nil
 }
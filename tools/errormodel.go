@@ -0,0 +1,158 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"math"
+	"math/rand"
+)
+
+// EndSpan is how many bases the extra errors of the read ends fade over.
+const EndSpan = 10
+
+// ErrorModel shapes where the errors of a strand fall, as nanopore errors
+// cluster. The zero model draws every base on its own.
+type ErrorModel struct {
+	// Burst is the mean length of a run of errors of one kind, drawn from a
+	// geometric distribution; 1 or less gives single errors. Runs start
+	// Burst times less often, so the rate of each base stays the same.
+	Burst float64
+	// Homopolymer is the chance, for every base beyond the first of a
+	// homopolymer run, that the run is read one base longer or shorter.
+	// These errors come on top of the rates.
+	Homopolymer float64
+	// Ends is how many times more errors the first and last bases get than
+	// the middle of the strand, fading over EndSpan bases; the mean rate
+	// stays the same. 1 or less gives the same rate everywhere.
+	Ends float64
+}
+
+func (m ErrorModel) Validate() error {
+	if m.Burst < 0 || m.Homopolymer < 0 || m.Homopolymer > 1 || m.Ends < 0 ||
+		math.IsNaN(m.Burst) || math.IsNaN(m.Homopolymer) || math.IsNaN(m.Ends) {
+		return &ParamsError{Msg: "burst and ends must not be negative, homopolymer must be in range [0, 1]"}
+	}
+	return nil
+}
+
+// Plain is whether every base is drawn on its own at its rates.
+func (m ErrorModel) Plain() bool {
+	return m.Burst <= 1 && m.Homopolymer == 0 && m.Ends <= 1
+}
+
+// weights gives the factor on the rate of every base of a strand of length
+// n, with mean 1.
+func (m ErrorModel) weights(n int) []float64 {
+	res := make([]float64, n)
+	sum := 0.0
+	for pos := range res {
+		res[pos] = 1
+		if m.Ends > 1 {
+			res[pos] += (m.Ends - 1) * (math.Exp(-float64(pos)/EndSpan) + math.Exp(-float64(n-1-pos)/EndSpan))
+		}
+		sum += res[pos]
+	}
+	for pos := range res {
+		res[pos] *= float64(n) / sum
+	}
+	return res
+}
+
+func (m ErrorModel) runLength(r *rand.Rand) int {
+	if m.Burst <= 1 {
+		return 1
+	}
+	q := 1 - 1/m.Burst
+	return 1 + int(math.Log(1-r.Float64())/math.Log(q))
+}
+
+// Mutate draws the fate of every base of s from its rates times scale:
+// substituted, deleted, followed by inserted bases, or kept, shaped by the
+// model. The three rates of a base are capped to add up to at most 1. It
+// also gives the error rate of the base each read base came from.
+func (m ErrorModel) Mutate(s string, rates []Kmer, scale float64, r *rand.Rand) (string, []float64) {
+	read := make([]byte, 0, len(s)+len(s)/10)
+	probs := make([]float64, 0, cap(read))
+	weights := m.weights(len(s))
+	burst := max(1, m.Burst)
+
+	var runOp byte
+	run := 0
+	for pos := 0; pos < len(s); pos++ {
+		c := s[pos]
+		x := rates[pos].X_rate * scale * weights[pos]
+		d := rates[pos].D_rate * scale * weights[pos]
+		in := rates[pos].I_rate * scale * weights[pos]
+		total := x + d + in
+		if total > 1 {
+			x, d, in, total = x/total, d/total, in/total, 1
+		}
+
+		if run > 0 {
+			run--
+			if runOp == EditSub && Nuc2Int(rune(c)) >= 0 {
+				read = append(read, byte(Int2Nuc((r.Intn(3)+Nuc2Int(rune(c))+1)&3)))
+				probs = append(probs, total)
+			}
+			continue
+		}
+
+		if m.Homopolymer > 0 && (pos == 0 || s[pos-1] != c) {
+			end := pos + 1
+			for end < len(s) && s[end] == c {
+				end++
+			}
+			if end-pos > 1 && r.Float64() < min(1, m.Homopolymer*float64(end-pos-1)) {
+				if r.Intn(2) == 0 {
+					read = append(read, c)
+					probs = append(probs, total)
+				} else {
+					continue
+				}
+			}
+		}
+
+		u := r.Float64() * burst
+		if u < x && Nuc2Int(rune(c)) >= 0 {
+			read = append(read, byte(Int2Nuc((r.Intn(3)+Nuc2Int(rune(c))+1)&3)))
+			probs = append(probs, total)
+			runOp, run = EditSub, m.runLength(r)-1
+		} else if u < x+d {
+			runOp, run = EditDel, m.runLength(r)-1
+		} else if u < x+d+in {
+			read = append(read, c)
+			probs = append(probs, total)
+			for k := m.runLength(r); k > 0; k-- {
+				read = append(read, byte(Int2Nuc(r.Intn(4))))
+				probs = append(probs, total)
+			}
+		} else {
+			read = append(read, c)
+			probs = append(probs, total)
+		}
+	}
+	return string(read), probs
+}
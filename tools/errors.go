@@ -0,0 +1,103 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNoReads          = errors.New("no reads")
+	ErrManifestNotFound = errors.New("manifest not found")
+	ErrInvalidManifest  = errors.New("invalid manifest")
+	ErrDigestMismatch   = errors.New("file digest mismatch")
+	ErrArchive          = errors.New("pool holds an archive")
+	ErrNotArchive       = errors.New("pool holds no archive, use Decode and Reconstruction instead")
+	ErrArchiveIndex     = errors.New("invalid archive index")
+	ErrClusters         = errors.New("clusters do not match the reads")
+)
+
+// ProfileError is a k-mer error profile that cannot be used; Gungnir and
+// Gungnir-ONT need it to build their rules.
+type ProfileError struct {
+	Path string
+	Err  error
+}
+
+func (e *ProfileError) Error() string {
+	return "error profile " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *ProfileError) Unwrap() error {
+	return e.Err
+}
+
+// ParamsError is a set of parameters no code can be built from.
+type ParamsError struct {
+	Msg string
+}
+
+func (e *ParamsError) Error() string {
+	return "invalid parameters: " + e.Msg
+}
+
+// BaseError is a character where a base is needed; Pos counts from 0.
+type BaseError struct {
+	What string
+	Pos  int
+	Base rune
+}
+
+func (e *BaseError) Error() string {
+	return fmt.Sprintf("%s: invalid base %q at %d", e.What, e.Base, e.Pos)
+}
+
+// LengthError is a sequence or table of the wrong length. With AtMost, Want
+// is a limit rather than the length expected.
+type LengthError struct {
+	What   string
+	Got    int
+	Want   int
+	AtMost bool
+}
+
+func (e *LengthError) Error() string {
+	if e.AtMost {
+		return fmt.Sprintf("%s has length %d, at most %d allowed", e.What, e.Got, e.Want)
+	}
+	return fmt.Sprintf("%s has length %d, want %d", e.What, e.Got, e.Want)
+}
+
+// CheckBases tells whether s holds only A, C, G and T.
+func CheckBases(what string, s string) error {
+	for i, c := range s {
+		if Nuc2Int(c) < 0 {
+			return &BaseError{What: what, Pos: i, Base: c}
+		}
+	}
+	return nil
+}
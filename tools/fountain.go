@@ -0,0 +1,414 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// In fountain mode the file is cut into source blocks as usual, but the
+// strands are droplets: the droplet with seed s is an ordinary block with
+// BlockID s whose payload is the XOR of source blocks drawn from a robust
+// soliton distribution seeded with s. The hash of a strand thus also checks
+// its seed, and any large enough set of decoded droplets gives the file back.
+type Fountain struct {
+	SourceNum int
+	cdf       []float64
+}
+
+const FountainC = 0.1
+const FountainDelta = 0.05
+
+// Droplets written when -seqnum is not given, as a share of the source blocks.
+const FountainOverhead = 0.5
+
+const FountainBatch = 1024
+
+// BlockIDs are kept in 16 bits by the decoder.
+const MaxBlockNum = Uint16Mask + 1
+
+func NewFountain(sourcenum int) *Fountain {
+	f := &Fountain{SourceNum: sourcenum, cdf: make([]float64, sourcenum)}
+	k := float64(sourcenum)
+	R := FountainC * math.Log(k/FountainDelta) * math.Sqrt(k)
+	spike := int(math.Round(k / R))
+
+	sum := 0.0
+	for d := 1; d <= sourcenum; d++ {
+		mu := 1.0 / k
+		if d > 1 {
+			mu = 1.0 / float64(d*(d-1))
+		}
+		if d < spike {
+			mu += R / (float64(d) * k)
+		} else if d == spike {
+			mu += R * math.Log(R/FountainDelta) / k
+		}
+		sum += mu
+		f.cdf[d-1] = sum
+	}
+	for d := 0; d < sourcenum; d++ {
+		f.cdf[d] /= sum
+	}
+	return f
+}
+
+// Sources gives the source blocks XORed into the droplet with this seed.
+func (f *Fountain) Sources(seed int) []int {
+	r := rand.New(rand.NewSource(int64(seed)))
+	degree := sort.SearchFloat64s(f.cdf, r.Float64()) + 1
+	if degree > f.SourceNum {
+		degree = f.SourceNum
+	}
+	if 2*degree > f.SourceNum {
+		return r.Perm(f.SourceNum)[:degree]
+	}
+	res := make([]int, 0, degree)
+	picked := make(map[int]bool)
+	for len(res) < degree {
+		s := r.Intn(f.SourceNum)
+		if !picked[s] {
+			picked[s] = true
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// SourceBlock reads the i-th source block of a file of size bytes.
+func SourceBlock(r io.ReaderAt, size int, i int, params Params) (Bitset, error) {
+	startbit := i * params.PayloadLen
+	start := startbit / 8
+	end := ((i+1)*params.PayloadLen + 7) / 8
+	if end > size {
+		end = size
+	}
+	buf := make([]byte, end-start)
+	if _, err := r.ReadAt(buf, int64(start)); err != nil && err != io.EOF {
+		return Bitset{}, err
+	}
+	bits := BitsetFromBytes(buf)
+	offset := startbit - 8*start
+	last := offset + params.PayloadLen
+	if last > bits.Len() {
+		last = bits.Len()
+	}
+	block := bits.Slice(offset, last)
+	block.Grow(params.PayloadLen)
+	return block, nil
+}
+
+// EncodeFountain writes dropletnum droplets of inputfile. With extend, they are
+// appended to the fountain pool already in outputpath, continuing its seeds,
+// and the pool keeps its primers.
+func EncodeFountain(inputfile string, outputpath string, params Params, primers PrimerPair, dropletnum int, extend bool) error {
+
+	if err := os.MkdirAll(outputpath, 0755); err != nil {
+		return err
+	}
+
+	Origin_Name, _, _ := Genfilename(outputpath)
+
+	in, err := os.Open(inputfile)
+	if err != nil {
+		return fmt.Errorf("fail to open input: %w", err)
+	}
+	defer in.Close()
+
+	digest := murmur3.New128()
+	size, err := io.Copy(digest, in)
+	if err != nil {
+		return fmt.Errorf("fail to read input: %w", err)
+	}
+	sourcenum := BlockNum(int(size), params.PayloadLen)
+	if dropletnum <= 0 {
+		dropletnum = int(math.Ceil(float64(sourcenum) * (1 + FountainOverhead)))
+	}
+
+	start := 0
+	var out *os.File
+	if extend {
+		primers = ReadPrimers(outputpath)
+		manifest, offset, ok := PoolManifest(Origin_Name, primers.Seed())
+		h1, h2 := digest.Sum128()
+		if !ok || !manifest.Fountain || manifest.Option != params.Option || manifest.HashLen != params.HashLen ||
+			manifest.PayloadLen != params.PayloadLen || manifest.FileLen != int(size) || !bytes.Equal(manifest.Digest, DigestBytes(h1, h2)) {
+			return fmt.Errorf("no fountain pool of this file and parameters to extend in %s", outputpath)
+		}
+		start = manifest.StrandNum
+		out, err = os.OpenFile(Origin_Name, os.O_WRONLY, 0644)
+		if err == nil {
+			err = out.Truncate(offset)
+		}
+		if err == nil {
+			_, err = out.Seek(offset, io.SeekStart)
+		}
+	} else {
+		out, err = os.Create(Origin_Name)
+	}
+	if err != nil {
+		return fmt.Errorf("fail to create output: %w", err)
+	}
+	defer out.Close()
+
+	if start+dropletnum > MaxBlockNum {
+		return fmt.Errorf("too many droplets, at most %d strands are allowed", MaxBlockNum)
+	}
+
+	params = params.WithPrimer(primers.Seed())
+	enc, err := NewStreamEncoder(out, params, OuterCode{}, -1, runtime.NumCPU())
+	if err != nil {
+		return fmt.Errorf("fail to encode: %w", err)
+	}
+	enc.blockID = start
+	enc.filelen = int(size)
+	enc.digest = digest
+	enc.fountain = true
+
+	f := NewFountain(sourcenum)
+	for seed := start; seed < start+dropletnum; seed += FountainBatch {
+		batch := FountainBatch
+		if seed+batch > start+dropletnum {
+			batch = start + dropletnum - seed
+		}
+		payloads := make([]Bitset, batch)
+		for i := 0; i < batch; i++ {
+			payloads[i] = NewBitset(params.PayloadLen)
+			for _, s := range f.Sources(seed + i) {
+				block, err := SourceBlock(in, int(size), s, params)
+				if err != nil {
+					return fmt.Errorf("fail to read input: %w", err)
+				}
+				payloads[i].Xor(block)
+			}
+		}
+		if err := enc.write(payloads); err != nil {
+			return fmt.Errorf("fail to encode: %w", err)
+		}
+	}
+
+	manifest, err := enc.Close()
+	if err != nil {
+		return fmt.Errorf("fail to encode: %w", err)
+	}
+
+	if err := WriteSynthesis(outputpath, primers); err != nil {
+		return err
+	}
+
+	fmt.Println("Source Num: ", sourcenum, " Strand Num: ", manifest.StrandNum)
+	return nil
+}
+
+// PoolManifest reads the manifest of an error-free pool file and the byte
+// offset where its header strands begin.
+func PoolManifest(filepath string, primer string) (Manifest, int64, bool) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return Manifest{}, 0, false
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	starts := make([]int64, 0)
+	seqs := make([]string, 0)
+	var offset int64
+	for {
+		line, err := reader.ReadString('\n')
+		if strings.HasPrefix(line, ">") {
+			starts = append(starts, offset)
+		} else if len(strings.TrimSpace(line)) > 0 {
+			seqs = append(seqs, strings.TrimSpace(line))
+		}
+		offset += int64(len(line))
+		if err != nil {
+			break
+		}
+	}
+
+	if len(seqs) != len(starts) {
+		return Manifest{}, 0, false
+	}
+	_, header, manifest, ok := SplitPool(seqs, primer, runtime.NumCPU())
+	if !ok {
+		return Manifest{}, 0, false
+	}
+	return manifest, starts[len(starts)-len(header)], true
+}
+
+func (m *Manifest) SourceNum() int {
+	return BlockNum(m.FileLen, m.PayloadLen)
+}
+
+// PeelDroplets takes droplets sorted by BlockID, where failed ones have no
+// payload, and returns the source blocks in file order. Droplets covering a
+// single unknown source are peeled first; what is left is solved by Gaussian
+// elimination. Sources that cannot be solved stay empty.
+func PeelDroplets(blocks []Block, sourcenum int, params Params) ([]Block, int) {
+	type droplet struct {
+		payload   Bitset
+		sources   []int
+		remaining int
+	}
+
+	f := NewFountain(sourcenum)
+	droplets := make([]droplet, 0)
+	bySource := make([][]int, sourcenum)
+	for seed := 0; seed < len(blocks); seed++ {
+		if len(blocks[seed].Payload) == 0 {
+			continue
+		}
+		d := droplet{payload: ReshapePayload(blocks[seed].Payload, params), sources: f.Sources(seed)}
+		d.remaining = len(d.sources)
+		for _, s := range d.sources {
+			bySource[s] = append(bySource[s], len(droplets))
+		}
+		droplets = append(droplets, d)
+	}
+
+	known := make([]bool, sourcenum)
+	res := make([]Block, sourcenum)
+	recovered := 0
+	resolve := func(s int, payload Bitset) {
+		known[s] = true
+		res[s] = Block{BlockID: s, Payload: []Bitset{payload}}
+		recovered++
+		for _, j := range bySource[s] {
+			if droplets[j].remaining > 0 {
+				droplets[j].payload.Xor(payload)
+				droplets[j].remaining--
+			}
+		}
+	}
+
+	queue := make([]int, 0)
+	for i := 0; i < len(droplets); i++ {
+		if droplets[i].remaining == 1 {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if droplets[i].remaining != 1 {
+			continue
+		}
+		for _, s := range droplets[i].sources {
+			if !known[s] {
+				payload := droplets[i].payload
+				droplets[i].remaining = 0
+				resolve(s, payload)
+				for _, j := range bySource[s] {
+					if droplets[j].remaining == 1 {
+						queue = append(queue, j)
+					}
+				}
+				break
+			}
+		}
+	}
+	if recovered == sourcenum {
+		return res, recovered
+	}
+
+	// Gaussian elimination over the sources peeling could not reach
+	column := make(map[int]int)
+	unknown := make([]int, 0)
+	for s := 0; s < sourcenum; s++ {
+		if !known[s] {
+			column[s] = len(unknown)
+			unknown = append(unknown, s)
+		}
+	}
+	rows := make([]Bitset, 0)
+	payloads := make([]Bitset, 0)
+	for i := 0; i < len(droplets); i++ {
+		if droplets[i].remaining == 0 {
+			continue
+		}
+		row := NewBitset(len(unknown))
+		for _, s := range droplets[i].sources {
+			if !known[s] {
+				row.Set(column[s], 1)
+			}
+		}
+		rows = append(rows, row)
+		payloads = append(payloads, droplets[i].payload)
+	}
+
+	pivots := make([]int, len(unknown))
+	rank := 0
+	for c := 0; c < len(unknown); c++ {
+		pivots[c] = -1
+		p := rank
+		for p < len(rows) && rows[p].Get(c) == 0 {
+			p++
+		}
+		if p == len(rows) {
+			continue
+		}
+		rows[rank], rows[p] = rows[p], rows[rank]
+		payloads[rank], payloads[p] = payloads[p], payloads[rank]
+		for r := 0; r < len(rows); r++ {
+			if r != rank && rows[r].Get(c) == 1 {
+				rows[r].Xor(rows[rank])
+				payloads[r].Xor(payloads[rank])
+			}
+		}
+		pivots[c] = rank
+		rank++
+	}
+
+	for c := 0; c < len(unknown); c++ {
+		if pivots[c] < 0 {
+			continue
+		}
+		// the source is solved when no unsolved column is left in its row
+		solved := true
+		for c2 := 0; c2 < len(unknown) && solved; c2++ {
+			if c2 != c && pivots[c2] < 0 && rows[pivots[c]].Get(c2) == 1 {
+				solved = false
+			}
+		}
+		if solved {
+			known[unknown[c]] = true
+			res[unknown[c]] = Block{BlockID: unknown[c], Payload: []Bitset{payloads[pivots[c]]}}
+			recovered++
+		}
+	}
+	return res, recovered
+}
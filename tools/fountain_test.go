@@ -0,0 +1,115 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPeelDroplets(t *testing.T) {
+	paramsRaw := GenParamsRaw(20, 80)
+	params, err := paramsRaw.Compile(Gungnir_Default_Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		sourcenum  int
+		dropletnum int
+		// keep tells which droplets decoded, by their sources
+		keep    func(seed int, sources []int) bool
+		wantAll bool
+	}{
+		{"every droplet", 20, 40, func(int, []int) bool { return true }, true},
+		{"lost droplets", 50, 100, func(seed int, _ []int) bool { return seed%4 != 0 }, true},
+		// without a droplet of degree 1 peeling cannot start
+		{"elimination only", 10, 80, func(_ int, sources []int) bool { return len(sources) > 1 }, true},
+		// one source peels, the rest is solved by elimination
+		{"peeling then elimination", 10, 80, func(_ int, sources []int) bool {
+			return len(sources) > 1 || sources[0] == 0
+		}, true},
+		{"too few droplets", 30, 12, func(int, []int) bool { return true }, false},
+		{"single source", 1, 3, func(int, []int) bool { return true }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(int64(tt.sourcenum)))
+			sources := make([]Bitset, tt.sourcenum)
+			for s := range sources {
+				sources[s] = NewBitset(params.PayloadLen)
+				for i := 0; i < params.PayloadLen; i++ {
+					sources[s].Set(i, rng.Intn(2))
+				}
+			}
+			f := NewFountain(tt.sourcenum)
+			blocks := make([]Block, tt.dropletnum)
+			kept := 0
+			for seed := 0; seed < tt.dropletnum; seed++ {
+				picked := f.Sources(seed)
+				if !tt.keep(seed, picked) {
+					continue
+				}
+				payload := NewBitset(params.PayloadLen)
+				for _, s := range picked {
+					payload.Xor(sources[s])
+				}
+				blocks[seed] = GenBlock(seed, payload, params)
+				kept++
+			}
+			if kept == 0 {
+				t.Fatal("no droplet kept")
+			}
+
+			res, recovered := PeelDroplets(blocks, tt.sourcenum, params)
+			if len(res) != tt.sourcenum {
+				t.Fatalf("%d source blocks, want %d", len(res), tt.sourcenum)
+			}
+			if tt.wantAll && recovered != tt.sourcenum {
+				t.Fatalf("recovered %d/%d", recovered, tt.sourcenum)
+			}
+			if !tt.wantAll && recovered == tt.sourcenum {
+				t.Fatalf("recovered every source from %d droplets", kept)
+			}
+			got := 0
+			for s := range res {
+				if len(res[s].Payload) == 0 {
+					continue
+				}
+				got++
+				if res[s].BlockID != s {
+					t.Errorf("source %d has BlockID %d", s, res[s].BlockID)
+				}
+				if !ReshapePayload(res[s].Payload, params).Equal(sources[s]) {
+					t.Errorf("source %d differs", s)
+				}
+			}
+			if got != recovered {
+				t.Errorf("%d sources returned, %d counted", got, recovered)
+			}
+		})
+	}
+}
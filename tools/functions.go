@@ -26,6 +26,7 @@
 package tools
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
@@ -42,79 +43,118 @@ func Genfilename(filepath string) (string, string, string) {
 	return Origin, Error, Decode
 }
 
-func EncodeFile(inputfile string, outputpath string, params Params, maximumseq int) {
+// outer adds Reed-Solomon parity strands across groups of data strands, see reedsolomon.go;
+// primers, when attached, make outputpath a sub-pool, see primer.go.
+func EncodeFile(inputfile string, outputpath string, params Params, outer OuterCode, primers PrimerPair, maximumseq int) error {
 
-	os.MkdirAll(outputpath, 0755)
+	if info, err := os.Stat(inputfile); err == nil && info.IsDir() {
+		return EncodeArchive(inputfile, outputpath, params, outer, primers)
+	}
+	if err := os.MkdirAll(outputpath, 0755); err != nil {
+		return err
+	}
 
 	Origin_Name, _, _ := Genfilename(outputpath)
 
-	file := Readfile(inputfile)
-
-	b := File2Bits(file)
-
-	d := BitsintoBlocks(b, params)
-
-	if maximumseq > 0 && maximumseq < len(d) {
-		d = d[:maximumseq]
+	in, err := os.Open(inputfile)
+	if err != nil {
+		return fmt.Errorf("fail to open input: %w", err)
 	}
+	defer in.Close()
 
-	fmt.Println("Strand Num: ", len(d))
-
-	ori_seqs := Encode(d, params)
+	out, err := os.Create(Origin_Name)
+	if err != nil {
+		return fmt.Errorf("fail to create output: %w", err)
+	}
+	defer out.Close()
+
+	c := NewCodec(params)
+	c.Outer = outer
+	c.Primers = primers
+	c.MaxSeq = maximumseq
+	c.Threads = runtime.NumCPU()
+	manifest, err := c.EncodeReader(in, out)
+	if err != nil {
+		return fmt.Errorf("fail to encode: %w", err)
+	}
+	if err := WriteSynthesis(outputpath, primers); err != nil {
+		return err
+	}
 
-	GenFasta(ori_seqs, Origin_Name)
+	fmt.Println("Strand Num: ", manifest.StrandNum)
+	return nil
 }
 
-// Sub = Total - Del - Ins
-func AddNoise(filepath string, Delrate, Insrate, ErrorRate float64) {
-	Origin_Name, Error_Name, _ := Genfilename(filepath)
+// Sub = Total - Del - Ins; with n.Bernoulli the rates are per base instead.
+func AddNoise(filepath string, Delrate, Insrate, ErrorRate float64, fliprate float64, n Noise) error {
+	return AddNoiseWithCoverage(filepath, Delrate, Insrate, ErrorRate, 0, fliprate, n)
+}
 
-	ori_seqs := ReadFasta(Origin_Name)
+// AddNoiseWithCoverage writes coverage noisy reads per strand on average, in
+// random order, to Reads; Cluster turns them into one read per strand.
+func AddNoiseWithCoverage(filepath string, Delrate, Insrate, ErrorRate float64, coverage float64, fliprate float64, n Noise) error {
 	Subrate := ErrorRate - Delrate - Insrate
-
-	seqs := AddError(ori_seqs, Subrate, Delrate, Insrate, ErrorRate) // Fixed Error Rate
-
-	GenFasta(seqs, Error_Name)
-
+	return writeNoise(filepath, coverage, fliprate, n, func(seqs []string) []string {
+		if n.Bernoulli {
+			return n.AddBernoulliError(seqs, Subrate, Delrate, Insrate)
+		}
+		return n.AddError(seqs, Subrate, Delrate, Insrate, ErrorRate) // Fixed Error Rate
+	})
 }
 
-func AnalysisFailure(set *IDtobeDecode, filepath string, params Params) (int, int) {
+// AddKmerNoise is AddNoise with the errors of every base drawn from the
+// current error profile, its rates multiplied by scale; coverage works as in
+// AddNoiseWithCoverage when above 0.
+func AddKmerNoise(filepath string, scale float64, coverage float64, fliprate float64, n Noise) error {
+	p, err := CurrentProfile()
+	if err != nil {
+		return err
+	}
+	return writeNoise(filepath, coverage, fliprate, n, func(seqs []string) []string {
+		return n.AddKmerError(seqs, p, scale)
+	})
+}
 
-	Origin_Name, _, Decode_Name := Genfilename(filepath)
-	seqs := ReadFasta(Origin_Name)
-	dec_seqs := ReadFasta(Decode_Name)
+// SampledFile holds the reads of AddNoise with a coverage under the output
+// path, for Cluster.
+const SampledFile = "/Reads"
 
-	data, _ := Readjson()
-	var zero_block Block
-	var zero_seq string
+func writeNoise(filepath string, coverage float64, fliprate float64, n Noise, addError func([]string) []string) error {
+	Origin_Name, Error_Name, _ := Genfilename(filepath)
 
-	if params.Option != Gungnir_Trit_Params {
-		zero_seq = Block2DNA(zero_block, data, params)
-	} else {
-		zero_seq = Block2DNA_Three(zero_block, params)
+	reads, err := LoadReads(Origin_Name)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", Origin_Name, err)
+	}
+	ori_seqs := Seqs(reads)
+	if coverage > 0 {
+		ori_seqs = n.SampleReads(ori_seqs, coverage)
 	}
 
-	fail := 0
-	tempset := make([]int, 0)
+	seqs := addError(ori_seqs)
+	seqs = n.FlipReads(seqs, fliprate)
 
-	for i := 0; i < len(seqs); i++ {
-		if Hamming_Distrance([]rune(dec_seqs[i]), []rune(zero_seq)) == 0 {
-			tempset = append(tempset, i)
-			fail++
+	if coverage <= 0 {
+		if err := GenFasta(seqs, Error_Name); err != nil {
+			return fmt.Errorf("fail to write %s: %w", Error_Name, err)
 		}
+		return nil
 	}
-	set.InitWithtempset(len(seqs), tempset)
-	fmt.Println("Total Sequences:", len(seqs), " Failure Sequnces:", fail)
-	return fail, len(seqs)
+	Reads_Name := filepath + SampledFile
+	if err := GenFasta(seqs, Reads_Name); err != nil {
+		return fmt.Errorf("fail to write %s: %w", Reads_Name, err)
+	}
+	fmt.Println("Reads:", len(seqs))
+	return nil
 }
 
 func AnalysisAll(filepath string, params Params) (float64, int, int, int) {
 	if params.Option != Gungnir_Trit_Params {
 		Origin_Name, _, Decode_Name := Genfilename(filepath)
-		seqs := ReadFasta(Origin_Name)
-		dec_seqs := ReadFasta(Decode_Name)
+		seqs, _, _, _ := SplitPool(ReadSeqs(Origin_Name), params.Primer, runtime.NumCPU())
+		dec_seqs, _, _, _ := SplitPool(ReadSeqs(Decode_Name), params.Primer, runtime.NumCPU())
 
-		data, _ := Readjson()
+		data := Profile()
 		var zero_block Block
 		zero_seq := Block2DNA(zero_block, data, params)
 
@@ -142,9 +182,9 @@ func AnalysisAll(filepath string, params Params) (float64, int, int, int) {
 		return suc_rate, fail, count - fail, len(seqs)
 	} else {
 		Origin_Name, _, Decode_Name := Genfilename(filepath)
-		seqs := ReadFasta(Origin_Name)
-		dec_seqs := ReadFasta(Decode_Name)
-		// err_seqs := ReadFasta(Error_Name)
+		seqs, _, _, _ := SplitPool(ReadSeqs(Origin_Name), params.Primer, runtime.NumCPU())
+		dec_seqs, _, _, _ := SplitPool(ReadSeqs(Decode_Name), params.Primer, runtime.NumCPU())
+		// err_seqs := ReadSeqs(Error_Name)
 		res := make([]int, 0)
 		count := 0
 		fail := 0
@@ -153,7 +193,11 @@ func AnalysisAll(filepath string, params Params) (float64, int, int, int) {
 			res = append(res, val)
 		}
 		var zero_block Block
-		zero_seq := Block2DNA_Three(zero_block, params)
+		zero_seq, err := Block2DNA_Three(zero_block, params)
+		if err != nil {
+			fmt.Println(err)
+			return 0, 0, 0, 0
+		}
 		// tempset := make([]int, 0)
 		for i := 0; i < len(res); i++ {
 			if res[i] != 0 {
@@ -171,237 +215,200 @@ func AnalysisAll(filepath string, params Params) (float64, int, int, int) {
 
 }
 
-// threads_num1: How many sequences in parallel; thread_num2: How many threads for each sequence
-func FirstDecode(filepath string, threads_num1, threads_num2 int, Hmax int, EDmax int, params Params) (int, int) {
-
-	var deco []Block
-	var deco_suc []bool
-
-	set := &IDtobeDecode{}
-
-	_, Error_Name, Decode_Name := Genfilename(filepath)
-
-	seqs := ReadFasta(Error_Name)
-
-	set.Init(len(seqs))
+// OrientationFile marks the reads that decoded as reverse complements.
+const OrientationFile = "/orientation"
 
+// DecodeReads picks the decoder for the code and the split of threads. The
+// search of read i is followed in stats[i] when stats is not nil.
+func DecodeReads(reads []Read, stats []SearchStats, Hmax int, threads_num1, threads_num2 int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool) {
+	seqs, quals := Seqs(reads), Quals(reads)
 	if params.Option != Gungnir_Trit_Params {
 		if threads_num2 == 1 {
-			deco, deco_suc = Decode_Parallel(seqs, Hmax, threads_num1, EDmax, set, params)
+			return Decode_Parallel(seqs, quals, stats, Hmax, threads_num1, EDmax, set, params)
 		} else if threads_num1 == 1 {
-			deco, deco_suc = Decode_Multithread(seqs, Hmax, threads_num2, EDmax, set, params)
-		} else {
-			deco, deco_suc = Decode_Mix(seqs, Hmax, threads_num1, threads_num2, EDmax, set, params)
-		}
-	} else {
-		if threads_num2 == 1 {
-			deco, deco_suc = Decode_Three_Parallel(seqs, Hmax, threads_num1, EDmax, set, params)
-		} else if threads_num1 == 1 {
-			deco, deco_suc = Decode_Three_Multithread(seqs, Hmax, threads_num2, EDmax, set, params)
-		} else {
-			deco, deco_suc = Decode_Three_Mix(seqs, Hmax, threads_num1, threads_num2, EDmax, set, params)
+			return Decode_Multithread(seqs, quals, stats, Hmax, threads_num2, EDmax, set, params)
 		}
+		return Decode_Mix(seqs, quals, stats, Hmax, threads_num1, threads_num2, EDmax, set, params)
 	}
-
-	res := make([]Block, len(seqs))
-
-	for i := 0; i < len(seqs); i++ {
-		if deco_suc[i] && deco[i].BlockID < len(seqs) {
-			if len(res[deco[i].BlockID].Hash) == 0 {
-				res[deco[i].BlockID] = deco[i]
-			}
-		}
-
+	if threads_num2 == 1 {
+		return Decode_Three_Parallel(seqs, quals, stats, Hmax, threads_num1, EDmax, set, params)
+	} else if threads_num1 == 1 {
+		return Decode_Three_Multithread(seqs, quals, stats, Hmax, threads_num2, EDmax, set, params)
 	}
-
-	dec_seqs_temp := Encode(res, params)
-
-	GenFasta(dec_seqs_temp, Decode_Name)
-	SaveBoolsToFile(deco_suc, filepath+"/whetheroutput")
-
-	fmt.Println("Decoded finished, Hmax:", Hmax)
-
-	return AnalysisFailure(set, filepath, params)
+	return Decode_Three_Mix(seqs, quals, stats, Hmax, threads_num1, threads_num2, EDmax, set, params)
 }
 
-func DealWithError(filepath string, threads_num1, threads_num2 int, Hmax int, EDmax int, params Params) (int, int) {
-	_, Error_Name, Decode_Name := Genfilename(filepath)
-
-	data, _ := Readjson()
-
-	dec_seqs := ReadFasta(Decode_Name)
-	err_seqs := ReadFasta(Error_Name)
-
-	set := &IDtobeDecode{}
-
-	AnalysisFailure(set, filepath, params)
-
-	deco_suc, _ := LoadBoolsFromFile(filepath + "/whetheroutput")
+// DecodeOriented decodes the reads forward, then tries the reverse complement
+// of those that failed. The reverse strand is only tried up to Maxhypo_reverse,
+// so the larger rounds are not doubled for reads that are simply noisy. Both
+// searches of a read add up in stats.
+func DecodeOriented(reads []Read, stats []SearchStats, Hmax int, threads_num1, threads_num2 int, EDmax int, set *IDtobeDecode, params Params) ([]Block, []bool, []bool) {
+	deco, deco_suc := DecodeReads(reads, stats, Hmax, threads_num1, threads_num2, EDmax, set, params)
+	reversed := make([]bool, len(reads))
+	if Hmax > Maxhypo_reverse {
+		return deco, deco_suc, reversed
+	}
 
-	tobefix := make([]string, 0)
-	tobefixID := make([]int, 0)
-	fixed := 0
-	for i := 0; i < len(err_seqs); i++ {
+	rev := make([]Read, 0)
+	revID := make([]int, 0)
+	for i := 0; i < len(reads); i++ {
 		if !deco_suc[i] {
-			tobefix = append(tobefix, err_seqs[i])
-			tobefixID = append(tobefixID, i)
+			rev = append(rev, reads[i].RevComp())
+			revID = append(revID, i)
 		}
 	}
-	fmt.Println(len(tobefix), " sequences with no output! Hmax:", Hmax)
-
-	var new_set []Block
-	var new_decres []bool
-
-	if params.Option != Gungnir_Trit_Params {
-		if threads_num2 == 1 {
-			new_set, new_decres = Decode_Parallel(tobefix, Hmax, threads_num1, EDmax, set, params)
-		} else if threads_num1 == 1 {
-			new_set, new_decres = Decode_Multithread(tobefix, Hmax, threads_num2, EDmax, set, params)
-		} else {
-			new_set, new_decres = Decode_Mix(tobefix, Hmax, threads_num1, threads_num2, EDmax, set, params)
+	var rev_stats []SearchStats
+	if stats != nil {
+		rev_stats = NewSearchStats(len(rev))
+	}
+	rev_deco, rev_suc := DecodeReads(rev, rev_stats, Hmax, threads_num1, threads_num2, EDmax, set, params)
+	for i := 0; i < len(rev); i++ {
+		if stats != nil {
+			stats[revID[i]].Add(rev_stats[i])
 		}
-	} else {
-		if threads_num2 == 1 {
-			new_set, new_decres = Decode_Three_Parallel(tobefix, Hmax, threads_num1, EDmax, set, params)
-		} else if threads_num1 == 1 {
-			new_set, new_decres = Decode_Three_Multithread(tobefix, Hmax, threads_num2, EDmax, set, params)
-		} else {
-			new_set, new_decres = Decode_Three_Mix(tobefix, Hmax, threads_num1, threads_num2, EDmax, set, params)
+		if rev_suc[i] {
+			deco[revID[i]] = rev_deco[i]
+			deco_suc[revID[i]] = true
+			reversed[revID[i]] = true
 		}
 	}
+	return deco, deco_suc, reversed
+}
 
-	for i := 0; i < len(new_set); i++ {
-		if new_decres[i] {
-			index := new_set[i].BlockID
-			if index >= len(dec_seqs) {
-				continue
-			}
-			if params.Option != Gungnir_Trit_Params {
-				deco_suc[tobefixID[i]] = true
-				dec_seqs[index] = Block2DNA(new_set[i], data, params)
-			} else {
-				deco_suc[tobefixID[i]] = true
-				dec_seqs[index] = Block2DNA_Three(new_set[i], params)
-			}
+// FileCodec is the Codec of the pool at filepath, with the primers kept there.
+// threads_num1: How many sequences in parallel; thread_num2: How many threads for each sequence
+func FileCodec(filepath string, params Params, threads_num1, threads_num2 int) *Codec {
+	c := NewCodec(params)
+	c.Primers = ReadPrimers(filepath)
+	c.Threads = threads_num1
+	c.ThreadsPerRead = threads_num2
+	c.Log = os.Stdout
+	return c
+}
 
-			fixed += 1
-		}
+// DecodeFile decodes the reads in Add_Error into Decoded, marking in
+// whetheroutput the reads that decoded and in orientation those reversed, and
+// reports every read in ReportJSON and ReportTSV.
+func DecodeFile(filepath string, c *Codec) error {
+	_, Error_Name, _ := Genfilename(filepath)
+	reads, err := LoadReads(Error_Name)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", Error_Name, err)
 	}
-	fmt.Println(len(tobefix), " no ouput, ", fixed, " fixed!")
-	SaveBoolsToFile(deco_suc, filepath+"/whetheroutput")
-	GenFasta(dec_seqs, Decode_Name)
-	return AnalysisFailure(set, filepath, params)
+	d, err := c.DecodeReads(reads)
+	if err != nil {
+		return fmt.Errorf("fail to decode: %w", err)
+	}
+	return WriteDecoding(filepath, d)
 }
 
-func DecodeWithEDmax(filepath string, threads_num1, threads_num2 int, params Params) {
-
-	var fail, old_fail int
-	var totalseq int
-	fisrt_decode := true
-
-	Continue := true
-	EDmax := 3
-
-	for Continue {
-		if fisrt_decode {
-			fail, totalseq = FirstDecode(filepath, threads_num1, threads_num2, Maxhypo_firstround, EDmax, params)
-			fisrt_decode = false
-			old_fail = totalseq
-			fmt.Println("First round Finished at Edit Distance upperbound: ", EDmax)
-		} else {
-			fail, _ = DealWithError(filepath, threads_num1, threads_num2, Maxhypo_firstround, EDmax, params)
-			fmt.Println("First round Finished at Edit Distance upperbound: ", EDmax)
-		}
-
-		if fail < old_fail {
-			if float64(fail)/float64(totalseq) < 0.5 {
-				old_fail = fail
-				fmt.Println("Second round begin!")
-				fail, _ = DealWithError(filepath, threads_num1, threads_num2, Maxhypo_secondround, EDmax, params)
-				fmt.Println("Second round Finished at Edit Distance upperbound: ", EDmax)
-			}
-
-			if float64(fail)/float64(totalseq) < 0.2 && fail < old_fail {
-				old_fail = fail
-				fmt.Println("Third round begin!")
-				fail, _ = DealWithError(filepath, threads_num1, threads_num2, Maxhypo_thirdround, EDmax, params)
-				fmt.Println("Third round Finished at Edit Distance upperbound: ", EDmax)
-			}
-
-			if float64(fail)/float64(totalseq) < 0.1 && fail < old_fail {
-				old_fail = fail
-				fmt.Println("Forth round begin!")
-				fail, _ = DealWithError(filepath, threads_num1, threads_num2, Maxhypo_forthround, EDmax, params)
-				fmt.Println("Forth round Finished at Edit Distance upperbound: ", EDmax)
-			}
-
-			if float64(fail)/float64(totalseq) < 0.01 && fail < old_fail {
-				fmt.Println("Fifth round begin!")
-				fail, _ = DealWithError(filepath, threads_num1, threads_num2, Maxhypo_ultra, EDmax, params)
-				fmt.Println("Fifth round Finished at Edit Distance upperbound: ", EDmax)
-			}
-
-		} else {
-			fmt.Println("Fail to decode at Edit Distance upperbound: ", EDmax)
-		}
-
-		EDmax += 1
-		old_fail = fail
-
-		if fail == 0 {
-			Continue = false
-		}
-
-		if EDmax > int(0.2*float64(params.MaxDepth)) {
-			Continue = false
-		}
-
+// WriteDecoding writes the decoded pool to Decoded, the reads that decoded to
+// whetheroutput, those reversed to orientation and every read to ReportJSON
+// and ReportTSV, then compares Decoded with Origin.
+func WriteDecoding(filepath string, d *Decoding) error {
+	_, _, Decode_Name := Genfilename(filepath)
+	strands, err := d.Strands()
+	if err != nil {
+		return fmt.Errorf("fail to decode: %w", err)
+	}
+	if err := GenFasta(strands, Decode_Name); err != nil {
+		return fmt.Errorf("fail to write %s: %w", Decode_Name, err)
+	}
+	if err := SaveBoolsToFile(d.Decoded, filepath+"/whetheroutput"); err != nil {
+		return err
+	}
+	if err := SaveBoolsToFile(d.Reversed, filepath+OrientationFile); err != nil {
+		return err
+	}
+	if err := WriteReport(d.Reports, filepath); err != nil {
+		return fmt.Errorf("fail to write the read report: %w", err)
 	}
 
-	suc_rate, fail, mistake, total := AnalysisAll(filepath, params)
+	suc_rate, fail, mistake, total := AnalysisAll(filepath, d.Params)
 	precision := float64(total-fail-mistake) / float64(total-fail)
 	recall := float64(total-fail) / float64(total)
 	fmt.Println("Data recovery: ", suc_rate, " Precision: ", precision, " Recall: ", recall)
+	return nil
 }
 
-func DecodeWithFixEDmax(filepath string, threads_num1, threads_num2 int, EDmax int, params Params) {
-	fmt.Println("First round begin!")
-	FirstDecode(filepath, threads_num1, threads_num2, Maxhypo_firstround, EDmax, params)
-	fmt.Println("First round finish!")
-
-	fmt.Println("Second round begin!")
-	DealWithError(filepath, threads_num1, threads_num2, Maxhypo_secondround, EDmax, params)
-	fmt.Println("Second round finish!")
-
-	fmt.Println("Third round begin!")
-	DealWithError(filepath, threads_num1, threads_num2, Maxhypo_thirdround, EDmax, params)
-	fmt.Println("Third round finish!")
+func DecodeWithEDmax(filepath string, threads_num1, threads_num2 int, params Params) error {
+	return DecodeFile(filepath, FileCodec(filepath, params, threads_num1, threads_num2))
+}
 
-	fmt.Println("Forth round begin!")
-	DealWithError(filepath, threads_num1, threads_num2, Maxhypo_forthround, EDmax, params)
-	fmt.Println("Forth round finish!")
+func DecodeWithFixEDmax(filepath string, threads_num1, threads_num2 int, EDmax int, params Params) error {
+	c := FileCodec(filepath, params, threads_num1, threads_num2)
+	c.EDmax = EDmax
+	return DecodeFile(filepath, c)
+}
 
-	suc_rate, fail, mistake, total := AnalysisAll(filepath, params)
-	precision := float64(total-fail-mistake) / float64(total-fail)
-	recall := float64(total-fail) / float64(total)
-	fmt.Println("Data recovery: ", suc_rate, " Precision: ", precision, " Recall: ", recall)
+// DecodeJoint decodes the clusters written by Cluster, all reads of a cluster
+// together, see Codec.DecodeClusters. Each cluster is reported under its
+// consensus read in ReportJSON and ReportTSV.
+func DecodeJoint(filepath string, threads_num int, params Params) error {
+	_, Error_Name, _ := Genfilename(filepath)
+	reads, err := LoadReads(Error_Name)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", Error_Name, err)
+	}
+	clusters, err := ReadClusters(filepath + ClustersFile)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", filepath+ClustersFile, err)
+	}
+	d, err := FileCodec(filepath, params, threads_num, 1).DecodeClusters(reads, clusters)
+	if errors.Is(err, ErrClusters) {
+		return fmt.Errorf("%w, run Cluster first", err)
+	}
+	if err != nil {
+		return fmt.Errorf("fail to decode: %w", err)
+	}
+	return WriteDecoding(filepath, d)
 }
 
-func ReconstructFile(filepath string, params Params) {
+// PartialSuffix marks a reconstructed file whose digest does not match the
+// manifest; it is kept for inspection and never written as output.
+const PartialSuffix = ".partial"
+
+// ReconstructFile writes the file of the decoded pool to output, or to
+// output.partial with ErrDigestMismatch when it fails the digest check.
+func ReconstructFile(filepath string, params Params) error {
 	_, _, Decode_Name := Genfilename(filepath)
 	numCores := runtime.NumCPU() * 2 / 3
-	set := &IDtobeDecode{}
-	dec_seqs := ReadFasta(Decode_Name)
-	set.Init(len(dec_seqs))
-	var datablock []Block
-	if params.Option != Gungnir_Trit_Params {
-		datablock, _ = Decode_Parallel(dec_seqs, Maxhypo_simple, numCores, 100, set, params)
-	} else {
-		datablock, _ = Decode_Three_Parallel(dec_seqs, Maxhypo_simple, numCores, 100, set, params)
+	if numCores < 1 {
+		numCores = 1
+	}
+	reads, err := LoadReads(Decode_Name)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", Decode_Name, err)
+	}
+	pool, err := FileCodec(filepath, params, numCores, 1).Recover(Seqs(reads))
+	if err != nil {
+		return fmt.Errorf("fail to reconstruct: %w", err)
+	}
+	if pool.Manifest.IsArchive() {
+		return RestoreArchive(pool.Blocks, pool.Manifest, pool.Params, filepath+"/output")
 	}
 
-	bits := BlocksintoBits(datablock, params)
+	content, err := pool.Content()
+	if errors.Is(err, ErrDigestMismatch) {
+		partial := filepath + "/output" + PartialSuffix
+		if werr := WriteStringToFile(Bytes2File(content), partial); werr != nil {
+			return werr
+		}
+		return fmt.Errorf("%w, written to %s", err, partial)
+	}
+	if err != nil {
+		return err
+	}
+	return WriteStringToFile(Bytes2File(content), filepath+"/output")
+}
 
-	file := Bits2File(bits)
-	WriteStringToFile(file, filepath+"/output")
+// SortBlocks places blocks by BlockID; missing ones stay empty and are read as zeros.
+func SortBlocks(blocks []Block, blocknum int) []Block {
+	res := make([]Block, blocknum)
+	for i := 0; i < len(blocks); i++ {
+		if blocks[i].BlockID >= 0 && blocks[i].BlockID < blocknum && len(blocks[i].Payload) > 0 {
+			res[blocks[i].BlockID] = blocks[i]
+		}
+	}
+	return res
 }
@@ -69,73 +69,44 @@ func HashScale(blockID, index int, previous int) int {
 	return int(Ran_hash(val) % 6)
 }
 
-func ReshapePayload(payload [][]int, params Params) []int {
-	new_payload := make([]int, params.PayloadLen)
-	count := 0
+func ReshapePayload(payload []Bitset, params Params) Bitset {
+	new_payload := NewBitset(0)
 	for i := 0; i < len(payload); i++ {
-		for j := 0; j < len(payload[i]); j++ {
-			new_payload[count] = payload[i][j]
-			count += 1
-		}
+		new_payload.Append(payload[i])
 	}
+	new_payload.Grow(params.PayloadLen)
 	return new_payload
 }
 
-func Hash0Payload(strandID int, fullpayload []int, params Params) []int {
-	data := Bits2Bytes(fullpayload)
+func Hash0Payload(strandID int, fullpayload Bitset, params Params) Bitset {
+	data := fullpayload.Bytes()
 	stranddata := IntToBytes(strandID)
 	data = append(data, stranddata...)
-	val := int(murmur3.Sum64(data)) & params.HashMask0
-	hash := make([]int, params.HashLenSet[0])
-	for i := 0; i < len(hash); i++ {
-		hash[i] = val & 1
-		val = val >> 1
-	}
-	return hash
+	val := int(murmur3.Sum64WithSeed(data, params.HashSeed)) & params.HashMask0
+	return BitsetFromUint(uint64(val), params.HashLenSet[0])
 }
 
-func HashIndex(strandID int, payloadIndex []int, hash0 []int, index int, params Params) []int {
-	hash := make([]int, params.HashLenSet[index])
-	data := Bits2Bytes(payloadIndex)
+func HashIndex(strandID int, payloadIndex Bitset, hash0 Bitset, index int, params Params) Bitset {
+	data := payloadIndex.Bytes()
 	stranddata := IntToBytes(strandID)
 	data = append(data, stranddata...)
-	hash0data := Bits2Bytes(hash0)
+	hash0data := hash0.Bytes()
 	data = append(data, hash0data...)
-	val := int(murmur3.Sum64(data))
+	val := int(murmur3.Sum64WithSeed(data, params.HashSeed))
 	if index == 1 {
 		val = val & params.HashMask1
 	} else {
 		val = val & Uint5Mask
 	}
-	for i := 0; i < len(hash); i++ {
-		hash[i] = val & 1
-		val = val >> 1
-	}
-	return hash
+	return BitsetFromUint(uint64(val), params.HashLenSet[index])
 }
 
-func JudgeHash0(strandID int, fullpayload []int, hash0 []int, params Params) bool {
+func JudgeHash0(strandID int, fullpayload Bitset, hash0 Bitset, params Params) bool {
 	new_hash := Hash0Payload(strandID, fullpayload, params)
-	if len(new_hash) != len(hash0) {
-		return false
-	}
-	for i := 0; i < len(new_hash); i++ {
-		if hash0[i] != new_hash[i] {
-			return false
-		}
-	}
-	return true
+	return new_hash.Equal(hash0)
 }
 
-func JudgeHashIndex(strandID int, payloadIndex []int, hash0 []int, hashthis []int, index int, params Params) bool {
+func JudgeHashIndex(strandID int, payloadIndex Bitset, hash0 Bitset, hashthis Bitset, index int, params Params) bool {
 	new_hash := HashIndex(strandID, payloadIndex, hash0, index, params)
-	if len(new_hash) != len(hashthis) {
-		return false
-	}
-	for i := 0; i < len(new_hash); i++ {
-		if hashthis[i] != new_hash[i] {
-			return false
-		}
-	}
-	return true
+	return new_hash.Equal(hashthis)
 }
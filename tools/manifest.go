@@ -0,0 +1,406 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// Manifest describes an encoded file. It is written as header strands after
+// the data strands so that decoding needs no encode-time flags.
+type Manifest struct {
+	Option     int
+	HashLen    int
+	PayloadLen int
+	FileLen    int
+	StrandNum  int
+	Digest     []byte
+	IndexLen   int
+	Outer      OuterCode
+	Fountain   bool
+}
+
+const ManifestMagic = "GN"
+const ManifestVersion = 5
+const ManifestBytes = 47
+const ManifestDigestBytes = 16
+const ManifestLength = 100
+const ManifestHashLen = 50
+
+// ManifestHashSeed gives header strands hashes of their own, so that data
+// strands of the same lengths never decode as header strands.
+const ManifestHashSeed = 0x4d4e4647
+
+// ManifestCopies copies of the manifest are written, so that it survives as
+// long as every header block decodes in one of them.
+const ManifestCopies = 3
+
+var SearchEDmaxSet = []int{3, 6, 10, 15, 20}
+
+const SearchBatch = 64
+
+// Header strands always use half of the bases for hash, whatever the data
+// density. Their lengths are fixed and always compile.
+func ManifestParams() Params {
+	paramsRaw := GenParamsRaw(ManifestHashLen, ManifestLength-ManifestHashLen)
+	params, _ := paramsRaw.Compile(Gungnir_Default_Params)
+	params.HashSeed = ManifestHashSeed
+	return params
+}
+
+// ManifestBlockNum is the number of blocks of one copy of the manifest.
+func ManifestBlockNum() int {
+	params := ManifestParams()
+	return (ManifestBytes*8 + params.PayloadLen - 1) / params.PayloadLen
+}
+
+func ManifestStrandNum() int {
+	return ManifestCopies * ManifestBlockNum()
+}
+
+// WithDefaulted marks params as defaults rather than the parameters of the
+// pool: decoding then fails without a manifest instead of using them.
+func (params Params) WithDefaulted(defaulted bool) Params {
+	params.Defaulted = defaulted
+	return params
+}
+
+// WithSkipManifest decodes the reads without searching them for the manifest,
+// for pools known to have none.
+func (params Params) WithSkipManifest(skip bool) Params {
+	params.SkipManifest = skip
+	return params
+}
+
+func FileDigest(content []byte) []byte {
+	h1, h2 := murmur3.Sum128(content)
+	return DigestBytes(h1, h2)
+}
+
+func DigestBytes(h1, h2 uint64) []byte {
+	digest := make([]byte, ManifestDigestBytes)
+	binary.LittleEndian.PutUint64(digest[:8], h1)
+	binary.LittleEndian.PutUint64(digest[8:], h2)
+	return digest
+}
+
+func GenManifest(content []byte, strandnum int, params Params) Manifest {
+	var m Manifest
+	m.Option = params.Option
+	m.HashLen = params.HashLen
+	m.PayloadLen = params.PayloadLen
+	m.FileLen = len(content)
+	m.StrandNum = strandnum
+	m.Digest = FileDigest(content)
+	return m
+}
+
+func (m *Manifest) Found() bool {
+	return m.StrandNum > 0
+}
+
+// Archives keep their index in the last data blocks, see archive.go.
+func (m *Manifest) IsArchive() bool {
+	return m.IndexLen > 0
+}
+
+// IndexStart counts data blocks, leaving out parity strands.
+func (m *Manifest) IndexStart() int {
+	return m.DataNum() - BlockNum(m.IndexLen, m.BlockBits())
+}
+
+// DataNum is the number of data strands; StrandNum also counts parity strands.
+func (m *Manifest) DataNum() int {
+	return m.Outer.DataNumOf(m.StrandNum)
+}
+
+func (m *Manifest) BlockBits() int {
+	return m.Outer.BlockBits(m.PayloadLen)
+}
+
+// Params fails for a manifest that decoded but describes no valid code.
+func (m *Manifest) Params() (Params, error) {
+	paramsRaw := GenParamsRaw(m.HashLen, m.PayloadLen)
+	return paramsRaw.Compile(m.Option)
+}
+
+func (m *Manifest) CheckDigest(content []byte) bool {
+	return len(content) == m.FileLen && bytes.Equal(FileDigest(content), m.Digest)
+}
+
+func (m *Manifest) Bytes() []byte {
+	b := make([]byte, ManifestBytes)
+	copy(b[0:2], ManifestMagic)
+	b[2] = ManifestVersion
+	b[3] = byte(m.Option)
+	binary.LittleEndian.PutUint16(b[4:6], uint16(m.HashLen))
+	binary.LittleEndian.PutUint16(b[6:8], uint16(m.PayloadLen))
+	binary.LittleEndian.PutUint64(b[8:16], uint64(m.FileLen))
+	binary.LittleEndian.PutUint32(b[16:20], uint32(m.StrandNum))
+	copy(b[20:20+ManifestDigestBytes], m.Digest)
+	binary.LittleEndian.PutUint32(b[36:40], uint32(m.IndexLen))
+	b[40] = byte(m.Outer.DataNum)
+	b[41] = byte(m.Outer.ParityNum)
+	if m.Fountain {
+		b[42] = 1
+	}
+	binary.LittleEndian.PutUint32(b[43:47], crc32.ChecksumIEEE(b[:43]))
+	return b
+}
+
+// ParseManifest also refuses manifests whose strands or file would not fit
+// the BlockIDs of the decoder, so that nothing is allocated for them.
+func ParseManifest(b []byte) (Manifest, bool) {
+	var m Manifest
+	if len(b) < ManifestBytes || string(b[0:2]) != ManifestMagic || b[2] != ManifestVersion {
+		return m, false
+	}
+	if binary.LittleEndian.Uint32(b[43:47]) != crc32.ChecksumIEEE(b[:43]) {
+		return m, false
+	}
+	m.Option = int(b[3])
+	m.HashLen = int(binary.LittleEndian.Uint16(b[4:6]))
+	m.PayloadLen = int(binary.LittleEndian.Uint16(b[6:8]))
+	m.FileLen = int(binary.LittleEndian.Uint64(b[8:16]))
+	m.StrandNum = int(binary.LittleEndian.Uint32(b[16:20]))
+	m.Digest = make([]byte, ManifestDigestBytes)
+	copy(m.Digest, b[20:20+ManifestDigestBytes])
+	m.IndexLen = int(binary.LittleEndian.Uint32(b[36:40]))
+	m.Outer.DataNum = int(b[40])
+	m.Outer.ParityNum = int(b[41])
+	m.Fountain = b[42] == 1
+	if m.Option > Gungnir_Trit_Params || m.PayloadLen == 0 {
+		return m, false
+	}
+	if m.StrandNum <= 0 || m.StrandNum > MaxBlockNum || m.FileLen > MaxBlockNum*m.PayloadLen/8 {
+		return m, false
+	}
+	return m, true
+}
+
+// Blocks are the ManifestCopies copies one after the other, so block i of
+// copy k has BlockID k*ManifestBlockNum()+i.
+func (m *Manifest) Blocks() []Block {
+	params := ManifestParams()
+	one := BitsintoBlocks(BitsetFromBytes(m.Bytes()), params)
+	blocks := make([]Block, 0, ManifestCopies*len(one))
+	for k := 0; k < ManifestCopies; k++ {
+		for i := 0; i < len(one); i++ {
+			blocks = append(blocks, GenBlock(k*len(one)+i, ReshapePayload(one[i].Payload, params), params))
+		}
+	}
+	return blocks
+}
+
+// A missing manifest has no strands, so that SplitPool does not take failed
+// header strands for data. Like data strands, they follow the forward primer
+// of the pool.
+func (m *Manifest) Strands(primer string) ([]string, error) {
+	if !m.Found() {
+		return nil, nil
+	}
+	return Encode(m.Blocks(), ManifestParams().WithPrimer(primer))
+}
+
+// ManifestFromBlocks takes blocks sorted by BlockID, failed ones without
+// payload, and reads each block of the manifest from the first copy that has
+// it.
+func ManifestFromBlocks(blocks []Block) (Manifest, bool) {
+	n := ManifestBlockNum()
+	merged := make([]Block, n)
+	for i := 0; i < n; i++ {
+		for k := i; k < len(blocks) && len(merged[i].Payload) == 0; k += n {
+			merged[i] = blocks[k]
+		}
+		if len(merged[i].Payload) == 0 {
+			return Manifest{}, false
+		}
+	}
+	bits := BlocksintoBits(merged, ManifestParams())
+	return ParseManifest(bits.Bytes())
+}
+
+// ManifestFromStrands reads the manifest back from error-free header strands.
+func ManifestFromStrands(header_seqs []string, primer string, threads_num int) (Manifest, bool) {
+	set := &IDtobeDecode{}
+	set.Init(len(header_seqs))
+	blocks, suc := Decode_Parallel(header_seqs, nil, nil, Maxhypo_simple, threads_num, 100, set, ManifestParams().WithPrimer(primer))
+	for i := 0; i < len(suc); i++ {
+		if !suc[i] {
+			return Manifest{}, false
+		}
+	}
+	return ManifestFromBlocks(SortBlocks(blocks, len(header_seqs)))
+}
+
+// Pool files (Origin, Decoded) hold the data strands followed by the header
+// strands. The tail is split off only once ManifestFromStrands reads it;
+// otherwise every strand is a data strand.
+func SplitPool(seqs []string, primer string, threads_num int) ([]string, []string, Manifest, bool) {
+	n := ManifestStrandNum()
+	if len(seqs) < n {
+		return seqs, nil, Manifest{}, false
+	}
+	manifest, ok := ManifestFromStrands(seqs[len(seqs)-n:], primer, threads_num)
+	if !ok {
+		return seqs, nil, Manifest{}, false
+	}
+	return seqs[:len(seqs)-n], seqs[len(seqs)-n:], manifest, true
+}
+
+// DecodeManifest searches the reads for header strands, starting from the tail
+// where the encoder puts them, and stops once every header block is recovered
+// in some copy. A pool where the first pass finds no header strand is taken to
+// have no manifest. flanklen is the FlankLen of the reads.
+func DecodeManifest(seqs []string, primer string, flanklen int, threads_num int) (Manifest, []bool, error) {
+	n := ManifestStrandNum()
+	ids := make([]int, n)
+	for i := 0; i < n; i++ {
+		ids[i] = i
+	}
+	isheader := make([]bool, len(seqs))
+	done := func(blocks []Block) bool {
+		_, ok := ManifestFromBlocks(blocks)
+		return ok
+	}
+	blocks, found := SearchBlocks(seqs, isheader, ids, threads_num, true, true, done, ManifestParams().WithPrimer(primer).WithFlank(flanklen))
+
+	if m, ok := ManifestFromBlocks(blocks); ok {
+		return m, isheader, nil
+	}
+	for i := 0; i < ManifestBlockNum(); i++ {
+		got := false
+		for k := i; k < n; k += ManifestBlockNum() {
+			got = got || len(blocks[k].Payload) > 0
+		}
+		if !got {
+			return Manifest{}, isheader, fmt.Errorf("%w: header strands recovered %d/%d", ErrManifestNotFound, found, n)
+		}
+	}
+	return Manifest{}, isheader, ErrInvalidManifest
+}
+
+// SearchBlocks decodes reads until every BlockID in ids is recovered, or done
+// tells that the blocks so far are enough when done is not nil, trying
+// all reads at one EDmax before the next. Only ids are tried as roots, so a
+// small Maxhypo is usually enough and reads of other blocks fail early; a last
+// pass with Maxhypo_firstround picks up what it missed. Decoded reads are
+// marked in used and skipped; blocks[k] holds ids[k]. Ids still missing are
+// then searched among the reverse complements of the unused reads. With
+// giveup, the search ends when the first pass over all reads finds none of ids.
+func SearchBlocks(seqs []string, used []bool, ids []int, threads_num int, fromtail bool, giveup bool, done func([]Block) bool, params Params) ([]Block, int) {
+	blocks := make([]Block, len(ids))
+	position := make(map[int]int)
+	maxid := 0
+	for k := 0; k < len(ids); k++ {
+		position[ids[k]] = k
+		if ids[k]+1 > maxid {
+			maxid = ids[k] + 1
+		}
+	}
+	set := &IDtobeDecode{}
+	set.InitWithtempset(maxid, ids)
+
+	batchsize := SearchBatch
+	if threads_num > batchsize {
+		batchsize = threads_num
+	}
+
+	found := 0
+	finished := false
+	search := func(seqs []string, Maxhypo int, EDmax int) {
+		for b := 0; b*batchsize < len(seqs) && !finished; b++ {
+			start := b * batchsize
+			end := start + batchsize
+			if end > len(seqs) {
+				end = len(seqs)
+			}
+			if fromtail {
+				start, end = len(seqs)-end, len(seqs)-start
+			}
+			batch := make([]string, 0)
+			batchID := make([]int, 0)
+			for i := start; i < end; i++ {
+				if !used[i] {
+					batch = append(batch, seqs[i])
+					batchID = append(batchID, i)
+				}
+			}
+			var deco []Block
+			var deco_suc []bool
+			if params.Option != Gungnir_Trit_Params {
+				deco, deco_suc = Decode_Parallel(batch, nil, nil, Maxhypo, threads_num, EDmax, set, params)
+			} else {
+				deco, deco_suc = Decode_Three_Parallel(batch, nil, nil, Maxhypo, threads_num, EDmax, set, params)
+			}
+			for i := 0; i < len(batch); i++ {
+				if deco_suc[i] {
+					used[batchID[i]] = true
+					k := position[deco[i].BlockID]
+					if len(blocks[k].Payload) == 0 {
+						blocks[k] = deco[i]
+						found++
+					}
+				}
+			}
+			finished = found == len(ids) || (done != nil && done(blocks))
+		}
+	}
+
+	for _, EDmax := range SearchEDmaxSet {
+		if EDmax > int(0.2*float64(params.MaxDepth)) {
+			break
+		}
+		search(seqs, Maxhypo_search, EDmax)
+		if giveup && found == 0 {
+			return blocks, found
+		}
+	}
+	// a wider tree for reads the small Maxhypo missed
+	search(seqs, Maxhypo_firstround, SearchEDmaxSet[0])
+
+	// reads that came back reverse complemented, with the small Maxhypo only
+	if !finished {
+		rev := make([]string, len(seqs))
+		for i := 0; i < len(seqs); i++ {
+			if !used[i] {
+				rev[i] = GenRevString(seqs[i])
+			}
+		}
+		for _, EDmax := range SearchEDmaxSet {
+			if EDmax > int(0.2*float64(params.MaxDepth)) {
+				break
+			}
+			search(rev, Maxhypo_search, EDmax)
+		}
+	}
+	return blocks, found
+}
@@ -27,7 +27,7 @@
 package tools
 
 import (
-	"log"
+	"fmt"
 	"math"
 )
 
@@ -60,6 +60,13 @@ type Params struct {
 	Seven3num               int
 	Res3num                 int
 	MaxHashPackage          int
+	Primer                  string
+	FlankLen                int
+	Scoring                 *KmerCost
+	MinConfidence           float64
+	Defaulted               bool
+	SkipManifest            bool
+	HashSeed                uint32
 }
 
 func GenParamsRaw(hashlen, payloadlen int) ParamsRaw {
@@ -69,8 +76,14 @@ func GenParamsRaw(hashlen, payloadlen int) ParamsRaw {
 	return p
 }
 
-func (paramsraw *ParamsRaw) Compile(option int) Params {
+func (paramsraw *ParamsRaw) Compile(option int) (Params, error) {
 	var params Params
+	if option < Gungnir_Default_Params || option > Gungnir_Trit_Params {
+		return params, &ParamsError{Msg: fmt.Sprintf("unknown option %d", option)}
+	}
+	if paramsraw.HashLen < 0 || paramsraw.PayloadLen <= 0 {
+		return params, &ParamsError{Msg: fmt.Sprintf("hash length %d and payload length %d", paramsraw.HashLen, paramsraw.PayloadLen)}
+	}
 	if option == Gungnir_Trit_Params {
 		params.Option = Gungnir_Trit_Params
 		params.HashLen = paramsraw.HashLen
@@ -116,7 +129,7 @@ func (paramsraw *ParamsRaw) Compile(option int) Params {
 			numSegments := params.Seven3num - params.MaxHashPackage
 
 			if numSegments <= 0 {
-				log.Fatal("Invalid configuration: Not enough segments for hash distribution!")
+				return Params{}, &ParamsError{Msg: "not enough segments for hash distribution"}
 			}
 
 			// Calculate average hash length per segment
@@ -151,11 +164,11 @@ func (paramsraw *ParamsRaw) Compile(option int) Params {
 			}
 
 			if totalHashBits != params.HashLen {
-				log.Fatalf("Hash bit allocation error: allocated %d bits but need %d bits", totalHashBits, params.HashLen)
+				return Params{}, &ParamsError{Msg: fmt.Sprintf("allocated %d hash bits but need %d", totalHashBits, params.HashLen)}
 			}
 
 			if totalPayloadBits != params.PayloadLen {
-				log.Fatalf("Payload bit allocation error: allocated %d bits but need %d bits", totalPayloadBits, params.PayloadLen)
+				return Params{}, &ParamsError{Msg: fmt.Sprintf("allocated %d payload bits but need %d", totalPayloadBits, params.PayloadLen)}
 			}
 
 			params.CheckPoint = make([]int, numSegments+1)
@@ -276,14 +289,83 @@ func (paramsraw *ParamsRaw) Compile(option int) Params {
 			params.Balance_Bound = 0.29
 		}
 	}
-	return params
+	if params.MaxDepth > MaxStrandLen {
+		return Params{}, &LengthError{What: "strand", Got: params.MaxDepth, Want: MaxStrandLen, AtMost: true}
+	}
+	params.Primer = Primer
+	return params, nil
+}
+
+// Validate checks params as set after Compile, primer and flanks included.
+func (params Params) Validate() error {
+	if params.MaxDepth == 0 {
+		return &ParamsError{Msg: "not compiled"}
+	}
+	if err := CheckBases("primer", params.Primer); err != nil {
+		return err
+	}
+	if len(params.Primer) < KmerSize {
+		return &LengthError{What: "primer", Got: len(params.Primer), Want: KmerSize}
+	}
+	if params.FlankLen < 0 || params.FlankLen > MaxFlankLenFree {
+		return &ParamsError{Msg: fmt.Sprintf("flank length %d not in [0, %d]", params.FlankLen, MaxFlankLenFree)}
+	}
+	return nil
 }
 
 const Gungnir_Default_Params = 0
 const Gungnir_ONT_Params = 1
 const Gungnir_Trit_Params = 2
+
+// OptionNames are the options by their names on the command line.
+var OptionNames = map[string]int{
+	"Gungnir":      Gungnir_Default_Params,
+	"Gungnir-ONT":  Gungnir_ONT_Params,
+	"Gungnir-Trit": Gungnir_Trit_Params,
+}
+
+const (
+	Gungnir_Min_Density = 0.5
+	Gungnir_Max_Density = 0.9
+	Trit_Min_Density    = 0.5
+	Trit_Max_Density    = 1.5
+)
+
+// SizeParams compiles the params of the named option for strands of seqlen
+// bases carrying density bits per base: Gungnir-Trit strands hold 11 bits per
+// 7 bases, hash included. The command line and Benchmark both size their
+// params here.
+func SizeParams(option string, density float64, seqlen int) (Params, error) {
+	config, ok := OptionNames[option]
+	if !ok {
+		return Params{}, &ParamsError{Msg: "unknown option " + option}
+	}
+	min, max := Gungnir_Min_Density, Gungnir_Max_Density
+	if config == Gungnir_Trit_Params {
+		min, max = Trit_Min_Density, Trit_Max_Density
+	}
+	if density < min || density > max {
+		return Params{}, &ParamsError{Msg: fmt.Sprintf("density %.2f of %s not in [%.2f, %.2f]", density, option, min, max)}
+	}
+	PayloadLen := int(math.Round(float64(seqlen) * density))
+	HashLen := seqlen - PayloadLen
+	if config == Gungnir_Trit_Params {
+		HashLen = (seqlen*11)/7 - PayloadLen
+	}
+	if HashLen < 0 {
+		return Params{}, &ParamsError{Msg: fmt.Sprintf("density %.2f too high for length %d", density, seqlen)}
+	}
+	paramsRaw := GenParamsRaw(HashLen, PayloadLen)
+	return paramsRaw.Compile(config)
+}
+
 const Primer = "TCGAAGTCAGCGTGTATTGTATG"
 const KmerSize = 7
+
+// MaxStrandLen keeps the GC count of a strand within the 8 bits a hypothesis
+// has for it; MaxReadLen keeps read positions within their 9 bits.
+const MaxStrandLen = Uint8Mask
+const MaxReadLen = Uint9Mask
 const Uint40Mask = (1 << 40) - 1
 const Maxhypo_firstround = 100000
 const Maxhypo_secondround = 1000000
@@ -291,6 +373,8 @@ const Maxhypo_thirdround = 5000000
 const Maxhypo_forthround = 20000000
 const Maxhypo_ultra = 200000000
 const Maxhypo_simple = 100
+const Maxhypo_search = 1000
+const Maxhypo_reverse = Maxhypo_firstround
 const Uint5Mask = (1 << 5) - 1
 const Uint8Mask = (1 << 8) - 1
 const Uint9Mask = (1 << 9) - 1
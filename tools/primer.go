@@ -0,0 +1,334 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A sub-pool is one encoded file (or directory) whose strands carry their own
+// primer pair: forward primer + strand + reverse complement of the reverse
+// primer. Origin keeps the bare strands so that decoding and analysis work as
+// for any pool; Synthesis holds the full strands with primers attached, and
+// Primers the pair itself. The encoder and decoder seed the constraint state
+// of every strand with the end of the forward primer that precedes it.
+type PrimerPair struct {
+	Forward string
+	Reverse string
+}
+
+const PrimerFile = "/Primers"
+const SynthesisFile = "/Synthesis"
+
+// Shorter primers are not told apart reliably at PrimerMaxErrorRate.
+const MinPrimerLen = 12
+const PrimerMaxErrorRate = 0.2
+
+// MaxFlankLen bounds the adapter and random bases searched before a primer.
+const MaxFlankLen = 64
+
+func ValidPrimer(primer string) bool {
+	if len(primer) < MinPrimerLen {
+		return false
+	}
+	for _, c := range primer {
+		if !strings.ContainsRune("ACGT", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (params Params) WithPrimer(primer string) Params {
+	params.Primer = primer
+	return params
+}
+
+func (p PrimerPair) Attached() bool {
+	return p.Forward != "" && p.Reverse != ""
+}
+
+// Seed is the sequence that precedes every strand, Primer when none is attached.
+func (p PrimerPair) Seed() string {
+	if !p.Attached() {
+		return Primer
+	}
+	return p.Forward
+}
+
+func (p PrimerPair) Attach(strand string) string {
+	return p.Forward + strand + GenRevString(p.Reverse)
+}
+
+// LocatePrimer aligns the whole primer within the first MaxFlankLen bases and
+// primer length of the read. Read bases before the primer, such as adapters
+// and random flanks, are free. It returns the edit distance and where the
+// primer ends.
+func LocatePrimer(primer string, read string) (int, int) {
+	m := len(primer)
+	n := MaxFlankLen + m + int(PrimerMaxErrorRate*float64(m)) + 1
+	if n > len(read) {
+		n = len(read)
+	}
+	prev := make([]int, n+1)
+	cur := make([]int, n+1)
+	for i := 1; i <= m; i++ {
+		cur[0] = i
+		for j := 1; j <= n; j++ {
+			cost := 1
+			if primer[i-1] == read[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j-1]+cost, prev[j]+1, cur[j-1]+1)
+		}
+		prev, cur = cur, prev
+	}
+	best, end := prev[0], 0
+	for j := 1; j <= n; j++ {
+		if prev[j] < best {
+			best, end = prev[j], j
+		}
+	}
+	return best, end
+}
+
+func reverse(s string) string {
+	res := []byte(s)
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return string(res)
+}
+
+// Bounds finds both primers near the ends of a read and returns where the
+// strand between them starts and ends, and the total edit distance of the
+// primers; whatever lies outside the primers is cut off.
+func (p PrimerPair) Bounds(read string) (int, int, int, bool) {
+	fd, start := LocatePrimer(p.Forward, read)
+	rd, tail := LocatePrimer(reverse(GenRevString(p.Reverse)), reverse(read))
+	if float64(fd) > PrimerMaxErrorRate*float64(len(p.Forward)) || float64(rd) > PrimerMaxErrorRate*float64(len(p.Reverse)) {
+		return 0, 0, 0, false
+	}
+	if start > len(read)-tail {
+		return 0, 0, 0, false
+	}
+	return start, len(read) - tail, fd + rd, true
+}
+
+func (p PrimerPair) Strip(read string) (string, int, bool) {
+	start, end, dist, ok := p.Bounds(read)
+	if !ok {
+		return "", 0, false
+	}
+	return read[start:end], dist, true
+}
+
+// Orient strips the primers from whichever strand of the read carries them
+// better and reports whether the read came back reverse complemented.
+func (p PrimerPair) Orient(read Read) (Read, int, bool, bool) {
+	start, end, dist, ok := p.Bounds(read.Seq)
+	rev := read.RevComp()
+	rstart, rend, rdist, rok := p.Bounds(rev.Seq)
+	if rok && (!ok || rdist < dist) {
+		return rev.Slice(rstart, rend), rdist, true, true
+	}
+	if !ok {
+		return Read{}, 0, false, false
+	}
+	return read.Slice(start, end), dist, false, true
+}
+
+func WritePrimers(filepath string, p PrimerPair) error {
+	return WriteStringToFile(p.Forward+"\n"+p.Reverse+"\n", filepath+PrimerFile)
+}
+
+// ReadPrimers gives the primer pair of a sub-pool, or an empty pair.
+func ReadPrimers(filepath string) PrimerPair {
+	lines := strings.Fields(Readfile(filepath + PrimerFile))
+	if len(lines) != 2 {
+		return PrimerPair{}
+	}
+	return PrimerPair{Forward: lines[0], Reverse: lines[1]}
+}
+
+// WriteSynthesis records the primer pair of a freshly encoded pool and writes
+// its strands with the primers attached.
+func WriteSynthesis(outputpath string, p PrimerPair) error {
+	Origin_Name, _, _ := Genfilename(outputpath)
+	if !p.Attached() {
+		os.Remove(outputpath + PrimerFile)
+		os.Remove(outputpath + SynthesisFile)
+		return nil
+	}
+	if err := WritePrimers(outputpath, p); err != nil {
+		return fmt.Errorf("fail to write primers: %w", err)
+	}
+
+	in, err := os.Open(Origin_Name)
+	if err != nil {
+		return fmt.Errorf("fail to open pool: %w", err)
+	}
+	defer in.Close()
+	out, err := os.Create(outputpath + SynthesisFile)
+	if err != nil {
+		return fmt.Errorf("fail to create output: %w", err)
+	}
+	defer out.Close()
+
+	scanner := bufio.NewScanner(in)
+	w := bufio.NewWriter(out)
+	index := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ">") {
+			continue
+		}
+		WriteFastaRecord(w, index, p.Attach(line))
+		index++
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("fail to write synthesis strands: %w", err)
+	}
+	return nil
+}
+
+// SubPools lists the sub-pools directly under pooldir, by name.
+func SubPools(pooldir string) ([]string, []PrimerPair, error) {
+	names := make([]string, 0)
+	pairs := make([]PrimerPair, 0)
+	entries, err := os.ReadDir(pooldir)
+	if err != nil {
+		return names, pairs, fmt.Errorf("fail to read pool: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		p := ReadPrimers(filepath.Join(pooldir, e.Name()))
+		if p.Attached() {
+			names = append(names, e.Name())
+			pairs = append(pairs, p)
+		}
+	}
+	if len(names) == 0 {
+		return names, pairs, fmt.Errorf("no sub-pool with primers in %s", pooldir)
+	}
+	return names, pairs, nil
+}
+
+// MixPool puts the synthesis strands of every sub-pool under pooldir into
+// one pool at outputpath, to be sequenced (AddNoise) as a whole.
+func MixPool(pooldir string, outputpath string) error {
+	names, _, err := SubPools(pooldir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outputpath, 0755); err != nil {
+		return err
+	}
+	Origin_Name, _, _ := Genfilename(outputpath)
+
+	seqs := make([]string, 0)
+	for _, name := range names {
+		Synthesis_Name := filepath.Join(pooldir, name) + SynthesisFile
+		sub, err := LoadReads(Synthesis_Name)
+		if err != nil {
+			return fmt.Errorf("fail to read %s: %w", Synthesis_Name, err)
+		}
+		fmt.Println("Sub-pool:", name, " Strand Num:", len(sub))
+		seqs = append(seqs, Seqs(sub)...)
+	}
+	if err := GenFasta(seqs, Origin_Name); err != nil {
+		return fmt.Errorf("fail to write %s: %w", Origin_Name, err)
+	}
+	return nil
+}
+
+// RoutePool sorts the reads of the mixed pool at outputpath by primer pair,
+// strips the primers and writes them as the reads of each sub-pool, which
+// are then decoded on their own. With name, only that sub-pool is amplified.
+func RoutePool(pooldir string, outputpath string, name string) error {
+	names, pairs, err := SubPools(pooldir)
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		for i := range names {
+			if names[i] == name {
+				names, pairs = names[i:i+1], pairs[i:i+1]
+				break
+			}
+		}
+		if len(names) != 1 || names[0] != name {
+			return fmt.Errorf("sub-pool not found: %s", name)
+		}
+	}
+
+	_, Error_Name, _ := Genfilename(outputpath)
+	reads, err := LoadReads(Error_Name)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", Error_Name, err)
+	}
+
+	routed := make([][]Read, len(names))
+	unassigned, reversed := 0, 0
+	for _, read := range reads {
+		best, bestdist, bestrev := -1, 0, false
+		var strand Read
+		for i := range pairs {
+			s, dist, rev, ok := pairs[i].Orient(read)
+			if ok && (best < 0 || dist < bestdist) {
+				best, bestdist, bestrev, strand = i, dist, rev, s
+			}
+		}
+		if best < 0 {
+			unassigned++
+			continue
+		}
+		if bestrev {
+			reversed++
+		}
+		routed[best] = append(routed[best], strand)
+	}
+
+	for i := range names {
+		_, Sub_Error_Name, _ := Genfilename(filepath.Join(pooldir, names[i]))
+		if err := WriteReads(routed[i], Sub_Error_Name); err != nil {
+			return fmt.Errorf("fail to write %s: %w", Sub_Error_Name, err)
+		}
+		fmt.Println("Sub-pool:", names[i], " Reads:", len(routed[i]))
+	}
+	fmt.Println("Total Reads:", len(reads), " Unassigned:", unassigned, " Reverse complemented:", reversed)
+	return nil
+}
@@ -0,0 +1,226 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	errorpattern "Gungnir/error_pattern"
+)
+
+// ErrorProfile holds the X, I and D rates of every k-mer, one table per
+// position of the base within the k-mer.
+type ErrorProfile struct {
+	Source    string
+	Tables    []map[string]Kmer
+	Rates     []float64
+	Sum       map[string]Kmer
+	ErrorRate float64
+}
+
+// DefaultProfile names the profile embedded in the binary.
+const DefaultProfile = "hg002_ONT"
+
+// LoadProfile reads a profile from path, or the embedded one when path is
+// empty. A directory holds one *_7_<position>.json table per position. A
+// file holds a list of the KmerSize tables, or a single table used for every
+// position.
+func LoadProfile(path string) (*ErrorProfile, error) {
+	if path == "" {
+		return loadTables("embedded "+DefaultProfile, errorpattern.Files)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, &ProfileError{Path: path, Err: err}
+	}
+	if info.IsDir() {
+		return loadTables(path, os.DirFS(path))
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &ProfileError{Path: path, Err: err}
+	}
+	var counts []map[string]Kmer_json
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(b, &counts); err != nil {
+			return nil, &ProfileError{Path: path, Err: err}
+		}
+		if len(counts) != KmerSize {
+			return nil, &ProfileError{Path: path, Err: &LengthError{What: "table list", Got: len(counts), Want: KmerSize}}
+		}
+	} else {
+		var table map[string]Kmer_json
+		if err := json.Unmarshal(b, &table); err != nil {
+			return nil, &ProfileError{Path: path, Err: err}
+		}
+		for i := 0; i < KmerSize; i++ {
+			counts = append(counts, table)
+		}
+	}
+	return NewErrorProfile(path, counts)
+}
+
+func loadTables(source string, fsys fs.FS) (*ErrorProfile, error) {
+	counts := make([]map[string]Kmer_json, KmerSize)
+	for i := 0; i < KmerSize; i++ {
+		pattern := "*_" + strconv.Itoa(KmerSize) + "_" + strconv.Itoa(i) + ".json"
+		names, _ := fs.Glob(fsys, pattern)
+		if len(names) != 1 {
+			return nil, &ProfileError{Path: source, Err: fmt.Errorf("want one %s table, found %d", pattern, len(names))}
+		}
+		b, err := fs.ReadFile(fsys, names[0])
+		if err != nil {
+			return nil, &ProfileError{Path: filepath.Join(source, names[0]), Err: err}
+		}
+		if err := json.Unmarshal(b, &counts[i]); err != nil {
+			return nil, &ProfileError{Path: filepath.Join(source, names[0]), Err: err}
+		}
+	}
+	return NewErrorProfile(source, counts)
+}
+
+// NewErrorProfile turns the counts of each position into rates; every table
+// must hold every k-mer.
+func NewErrorProfile(source string, counts []map[string]Kmer_json) (*ErrorProfile, error) {
+	p := &ErrorProfile{Source: source, Sum: make(map[string]Kmer)}
+	for i := 0; i < len(counts); i++ {
+		table, rate, err := RateTable(counts[i])
+		if err != nil {
+			return nil, &ProfileError{Path: source + " table " + strconv.Itoa(i), Err: err}
+		}
+		p.Tables = append(p.Tables, table)
+		p.Rates = append(p.Rates, rate)
+		p.ErrorRate += rate
+		for key, value := range table {
+			temp := p.Sum[key]
+			temp.D_rate += value.D_rate
+			temp.E_rate += value.E_rate
+			temp.I_rate += value.I_rate
+			temp.X_rate += value.X_rate
+			p.Sum[key] = temp
+		}
+	}
+	return p, nil
+}
+
+// RateTable gives the rates of each k-mer of data and the error rate of all.
+func RateTable(data map[string]Kmer_json) (map[string]Kmer, float64, error) {
+	if len(data) != KmerMask+1 {
+		return nil, 0, &LengthError{What: "k-mer table", Got: len(data), Want: KmerMask + 1}
+	}
+	for key, value := range data {
+		if len(key) != KmerSize {
+			return nil, 0, &LengthError{What: "k-mer " + key, Got: len(key), Want: KmerSize}
+		}
+		if err := CheckBases("k-mer "+key, key); err != nil {
+			return nil, 0, err
+		}
+		if value.Total <= 0 || value.X < 0 || value.I < 0 || value.D < 0 {
+			return nil, 0, fmt.Errorf("k-mer %s has invalid counts", key)
+		}
+	}
+
+	Xsum := big.NewInt(0)
+	Isum := big.NewInt(0)
+	Dsum := big.NewInt(0)
+	Totalsum := big.NewInt(0)
+
+	res := make(map[string]Kmer)
+	for key, value := range data {
+		var temp Kmer
+		temp.X_rate = float64(value.X) / float64(value.Total)
+		temp.I_rate = float64(value.I) / float64(value.Total)
+		temp.D_rate = float64(value.D) / float64(value.Total)
+		temp.E_rate = temp.X_rate + temp.I_rate + temp.D_rate
+		res[key] = temp
+
+		Xsum.Add(Xsum, big.NewInt(int64(value.X)))
+		Isum.Add(Isum, big.NewInt(int64(value.I)))
+		Dsum.Add(Dsum, big.NewInt(int64(value.D)))
+		Totalsum.Add(Totalsum, big.NewInt(int64(value.Total)))
+	}
+
+	Xfloat := new(big.Float).SetInt(Xsum)
+	Ifloat := new(big.Float).SetInt(Isum)
+	Dfloat := new(big.Float).SetInt(Dsum)
+	TotalFloat := new(big.Float).SetInt(Totalsum)
+
+	resultX := new(big.Float).Quo(Xfloat, TotalFloat)
+	resultI := new(big.Float).Quo(Ifloat, TotalFloat)
+	resultD := new(big.Float).Quo(Dfloat, TotalFloat)
+	xrate, _ := resultX.Float64()
+	irate, _ := resultI.Float64()
+	drate, _ := resultD.Float64()
+
+	error_rate := xrate + irate + drate
+
+	return res, error_rate, nil
+}
+
+var profiles = struct {
+	sync.Mutex
+	path   string
+	loaded map[string]*ErrorProfile
+}{loaded: make(map[string]*ErrorProfile)}
+
+// SetProfile selects the profile of the process; "" is the embedded one.
+// Each profile is loaded once and shared.
+func SetProfile(path string) error {
+	profiles.Lock()
+	defer profiles.Unlock()
+	if _, err := cachedProfile(path); err != nil {
+		return err
+	}
+	profiles.path = path
+	return nil
+}
+
+func CurrentProfile() (*ErrorProfile, error) {
+	profiles.Lock()
+	defer profiles.Unlock()
+	return cachedProfile(profiles.path)
+}
+
+func cachedProfile(path string) (*ErrorProfile, error) {
+	if p, ok := profiles.loaded[path]; ok {
+		return p, nil
+	}
+	p, err := LoadProfile(path)
+	if err != nil {
+		return nil, err
+	}
+	profiles.loaded[path] = p
+	return p, nil
+}
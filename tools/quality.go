@@ -0,0 +1,129 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+// ReadCost prices the edits against one read in fixed point, so penalties
+// stay integers and the pruning histograms keep working. Without qualities
+// every edit costs one. With them, a full edit costs QualityUnit, and
+// substituting or skipping a read base costs less when the basecaller was
+// unsure of it; deletions have no base of their own and always cost in full.
+// With k-mer scoring, Sub, Ins and Del further scale these by the context.
+// Stats, when set, follows the search of the read.
+type ReadCost struct {
+	Unit  int
+	Base  []int
+	tail  []int
+	Stats *SearchStats
+}
+
+const QualityUnit = 4
+
+// QualityFull is the Phred score from which a base costs a full edit.
+const QualityFull = 20
+
+// QualityCost maps a Phred score to 1..QualityUnit, so no edit is free.
+func QualityCost(q int) int {
+	c := (q*QualityUnit + QualityFull/2) / QualityFull
+	return max(1, min(c, QualityUnit))
+}
+
+// NewReadCost gives flat costs when qual is nil or does not fit the read.
+func NewReadCost(n int, qual []int, params Params) ReadCost {
+	c := ReadCost{Unit: 1, Base: make([]int, n), tail: make([]int, n+1)}
+	withqual := len(qual) == n && n > 0
+	if withqual || params.Scoring != nil {
+		c.Unit = QualityUnit
+	}
+	for j := 0; j < n; j++ {
+		c.Base[j] = c.Unit
+		if withqual {
+			c.Base[j] = QualityCost(qual[j])
+		}
+	}
+	for j := n - 1; j >= 0; j-- {
+		c.tail[j] = c.tail[j+1] + c.Base[j]
+	}
+	return c
+}
+
+// Sub is the cost of read base j standing for another strand base, which
+// closes the k-mer kmer.
+func (c ReadCost) Sub(j, kmer int, params Params) int {
+	if params.Scoring == nil {
+		return c.Base[j]
+	}
+	return scaleCost(c.Base[j], params.Scoring.X[kmer])
+}
+
+// Ins is the cost of read base j inserted after the k-mer kmer.
+func (c ReadCost) Ins(j, kmer int, params Params) int {
+	if params.Scoring == nil {
+		return c.Base[j]
+	}
+	return scaleCost(c.Base[j], params.Scoring.I[kmer])
+}
+
+// Del is the cost of losing the strand base that closes the k-mer kmer.
+func (c ReadCost) Del(kmer int, params Params) int {
+	if params.Scoring == nil {
+		return c.Unit
+	}
+	return scaleCost(c.Unit, params.Scoring.D[kmer])
+}
+
+func scaleCost(base, context int) int {
+	return max(1, (base*context+QualityUnit/2)/QualityUnit)
+}
+
+// Bound is the first penalty over EDmax edits.
+func (c ReadCost) Bound(EDmax int) int {
+	return EDmax*c.Unit + 1
+}
+
+// Tail is the cost of the read bases from index on, left after the last
+// strand base; the last FlankLen of them are free.
+func (c ReadCost) Tail(from int, params Params) int {
+	n := len(c.Base)
+	if n-from <= params.FlankLen {
+		return 0
+	}
+	return c.tail[from] - c.tail[n-params.FlankLen]
+}
+
+// QualAt is the quality of read i, nil when the reads have none.
+func QualAt(quals [][]int, i int) []int {
+	if quals == nil {
+		return nil
+	}
+	return quals[i]
+}
+
+// CostAt is the ReadCost of read i, following its search in stats when kept.
+func CostAt(seqs []string, quals [][]int, stats []SearchStats, i int, params Params) ReadCost {
+	c := NewReadCost(len(seqs[i]), QualAt(quals, i), params)
+	c.Stats = StatsAt(stats, i)
+	return c
+}
@@ -27,11 +27,7 @@ package tools
 
 import (
 	"bufio"
-	"compress/gzip"
-	"encoding/json"
 	"fmt"
-	"io"
-	"math/big"
 	"os"
 	"sort"
 	"strconv"
@@ -57,76 +53,48 @@ type Kmer_rank struct {
 	E_rate float64
 }
 
-func ReadjsonAll() (map[string]Kmer, []map[string]Kmer, float64) {
-	fulljson, errorjson := Readjson()
-	JsonSet := make([]map[string]Kmer, KmerSize)
-	for i := 0; i < KmerSize; i++ {
-		JsonSet[i], _ = ReadjsonIndex(i)
+// ReadjsonAll gives the tables of the selected profile, see SetProfile.
+func ReadjsonAll() (map[string]Kmer, []map[string]Kmer, float64, error) {
+	p, err := CurrentProfile()
+	if err != nil {
+		return nil, nil, 0, err
 	}
-
-	return fulljson, JsonSet, errorjson / KmerSize
+	return p.Sum, p.Tables, p.ErrorRate / KmerSize, nil
 }
 
-func Readjson() (map[string]Kmer, float64) {
-	res, errorrate := ReadjsonIndex(0)
-	for i := 1; i < KmerSize; i++ {
-		etable, etemp := ReadjsonIndex(i)
-		errorrate += etemp
-		for key, value := range etable {
-			temp := res[key]
-			temp.D_rate += value.D_rate
-			temp.E_rate += value.E_rate
-			temp.I_rate += value.I_rate
-			temp.X_rate += value.X_rate
-			res[key] = temp
-		}
+// Readjson sums the position tables of the selected profile. The map is
+// shared and must not be changed.
+func Readjson() (map[string]Kmer, float64, error) {
+	p, err := CurrentProfile()
+	if err != nil {
+		return nil, 0, err
 	}
-	return res, errorrate
+	return p.Sum, p.ErrorRate, nil
 }
 
-func ReadjsonIndex(Index int) (map[string]Kmer, float64) {
-	filepath := "../error_pattern/hg002_ONT_" + strconv.Itoa(KmerSize) + "_" + strconv.Itoa(Index) + ".json"
-	file, _ := os.Open(filepath)
-	defer file.Close()
-	byteValue, _ := io.ReadAll(file)
-	var data map[string]Kmer_json
-	json.Unmarshal(byteValue, &data)
-
-	Xsum := big.NewInt(0)
-	Isum := big.NewInt(0)
-	Dsum := big.NewInt(0)
-	Totalsum := big.NewInt(0)
+// Profile is the summed profile of Readjson. Entry points check it with
+// CheckProfile first, so the code below them takes it as read.
+func Profile() map[string]Kmer {
+	data, _, _ := Readjson()
+	return data
+}
 
-	res := make(map[string]Kmer)
-	for key, value := range data {
-		var temp Kmer
-		temp.X_rate = float64(value.X) / float64(value.Total)
-		temp.I_rate = float64(value.I) / float64(value.Total)
-		temp.D_rate = float64(value.D) / float64(value.Total)
-		temp.E_rate = temp.X_rate + temp.I_rate + temp.D_rate
-		res[key] = temp
-
-		Xsum.Add(Xsum, big.NewInt(int64(value.X)))
-		Isum.Add(Isum, big.NewInt(int64(value.I)))
-		Dsum.Add(Dsum, big.NewInt(int64(value.D)))
-		Totalsum.Add(Totalsum, big.NewInt(int64(value.Total)))
+// CheckProfile tells whether the profile the code of params needs is usable;
+// Gungnir-Trit needs none.
+func CheckProfile(params Params) error {
+	if params.Option == Gungnir_Trit_Params {
+		return nil
 	}
+	_, _, err := Readjson()
+	return err
+}
 
-	Xfloat := new(big.Float).SetInt(Xsum)
-	Ifloat := new(big.Float).SetInt(Isum)
-	Dfloat := new(big.Float).SetInt(Dsum)
-	TotalFloat := new(big.Float).SetInt(Totalsum)
-
-	resultX := new(big.Float).Quo(Xfloat, TotalFloat)
-	resultI := new(big.Float).Quo(Ifloat, TotalFloat)
-	resultD := new(big.Float).Quo(Dfloat, TotalFloat)
-	xrate, _ := resultX.Float64()
-	irate, _ := resultI.Float64()
-	drate, _ := resultD.Float64()
-
-	error_rate := xrate + irate + drate
-
-	return res, error_rate
+func ReadjsonIndex(Index int) (map[string]Kmer, float64, error) {
+	p, err := CurrentProfile()
+	if err != nil {
+		return nil, 0, err
+	}
+	return p.Tables[Index], p.Rates[Index], nil
 }
 
 func RankKmer(data map[string]Kmer) []Kmer_rank {
@@ -143,6 +111,7 @@ func RankKmer(data map[string]Kmer) []Kmer_rank {
 	return res
 }
 
+// Readfile gives the content of filepath, empty when it cannot be read.
 func Readfile(filepath string) string {
 	data, _ := os.ReadFile(filepath)
 	content := string(data)
@@ -203,19 +172,19 @@ func Bits2Bytes(bits []int) []byte {
 	return bytes
 }
 
-func File2Bits(content string) []int {
+func File2Bits(content string) Bitset {
 	bytes := File2bytes(content)
-	return Bytes2Bits(bytes)
+	return BitsetFromBytes(bytes)
 }
 
-func Bits2File(data []int) string {
-	bytes := Bits2Bytes(data)
+func Bits2File(data Bitset) string {
+	bytes := data.Bytes()
 	return Bytes2File(bytes)
 }
 
 // 0-less 1-more
 func Rank(symbol int, length int) {
-	data, _ := Readjson()
+	data := Profile()
 
 	rank := RankKmer(data)
 	for i := 0; i < length; i++ {
@@ -227,71 +196,28 @@ func Rank(symbol int, length int) {
 	}
 }
 
-func ReadFastqgz(filepath string) ([]string, [][]int) {
-	file, _ := os.Open(filepath)
-	defer file.Close()
-	reader, _ := gzip.NewReader(file)
-	defer reader.Close()
-	scanner := bufio.NewScanner(reader)
-	linenum := 0
-	sequence := make([]string, 0)
-	qual := make([][]int, 0)
-	for scanner.Scan() {
-		if linenum&3 == 1 {
-			sequence = append(sequence, scanner.Text())
-		}
-		if linenum&3 == 3 {
-			temp := scanner.Text()
-			qual_temp := make([]int, len(temp))
-			for i := 0; i < len(temp); i++ {
-				qual_temp[i] = int(temp[i]) - 33
-			}
-			qual = append(qual, qual_temp)
-		}
-		if linenum > 10 {
-			break
-		}
-		linenum += 1
+func GenFasta(sequence []string, filepath string) error {
+	f, err := os.Create(filepath)
+	if err != nil {
+		return err
 	}
-
-	return sequence, qual
-
-}
-
-func GenFasta(sequence []string, filepath string) {
-	f, _ := os.Create(filepath)
+	defer f.Close()
 	w := bufio.NewWriter(f)
 
 	for i := 0; i < len(sequence); i++ {
-		w.WriteString(">index_" + strconv.Itoa(i) + "\n")
-		w.WriteString(sequence[i] + "\n")
+		if err := WriteFastaRecord(w, i, sequence[i]); err != nil {
+			return err
+		}
 	}
-
-	w.Flush()
-	f.Close()
+	return w.Flush()
 }
 
-func ReadFasta(filepath string) []string {
-	file, _ := os.Open(filepath)
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-
-	res := make([]string, 0)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, ">") {
-			continue
-		} else {
-			if len(line) > 50 {
-				res = append(res, line)
-			}
-
-		}
+func WriteFastaRecord(w *bufio.Writer, index int, sequence string) error {
+	if _, err := w.WriteString(">index_" + strconv.Itoa(index) + "\n"); err != nil {
+		return err
 	}
-
-	return res
+	_, err := w.WriteString(sequence + "\n")
+	return err
 }
 
 func SaveBoolsToFile(deco_suc []bool, filepath string) error {
@@ -315,6 +241,16 @@ func SaveBoolsToFile(deco_suc []bool, filepath string) error {
 	return writer.Flush()
 }
 
+func CountTrue(vals []bool) int {
+	n := 0
+	for _, v := range vals {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
 func LoadBoolsFromFile(filepath string) ([]bool, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
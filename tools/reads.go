@@ -0,0 +1,444 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Read is one sequencing read. Qual holds its Phred scores and is nil for
+// FASTA input.
+type Read struct {
+	ID   string
+	Seq  string
+	Qual []int
+}
+
+// FormatError reports malformed input at a line of the file.
+type FormatError struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e *FormatError) Error() string {
+	return e.Path + ":" + strconv.Itoa(e.Line) + ": " + e.Msg
+}
+
+// ReadScanner streams the records of a FASTA or FASTQ file, plain or gzip.
+// Records may span several lines; blank lines between records are skipped.
+type ReadScanner struct {
+	path    string
+	file    *os.File
+	gz      *gzip.Reader
+	r       *bufio.Reader
+	line    int
+	pending string
+	held    bool
+	eof     bool
+	fastq   bool
+	read    Read
+	err     error
+}
+
+// OpenReads tells gzip from its magic bytes and FASTQ from FASTA from the
+// first character of the file.
+func OpenReads(filepath string) (*ReadScanner, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewReadScanner(file, filepath)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.file = file
+	return s, nil
+}
+
+// NewReadScanner streams the reads of r like OpenReads; name stands for r in
+// errors. Close does not close r.
+func NewReadScanner(in io.Reader, name string) (*ReadScanner, error) {
+	var err error
+	s := &ReadScanner{path: name}
+	r := bufio.NewReader(in)
+	if magic, _ := r.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		s.gz, err = gzip.NewReader(r)
+		if err != nil {
+			return nil, &FormatError{Path: name, Line: 0, Msg: "bad gzip header: " + err.Error()}
+		}
+		r = bufio.NewReader(s.gz)
+	}
+	s.r = r
+
+	line, ok := s.nextLine()
+	if !ok {
+		if s.err != nil {
+			s.Close()
+			return nil, s.err
+		}
+		return s, nil
+	}
+	switch {
+	case strings.HasPrefix(line, ">"):
+	case strings.HasPrefix(line, "@"):
+		s.fastq = true
+	default:
+		s.Close()
+		return nil, &FormatError{Path: name, Line: s.line, Msg: "expected '>' or '@' to start a record"}
+	}
+	s.unread(line)
+	return s, nil
+}
+
+func (s *ReadScanner) IsFastq() bool {
+	return s.fastq
+}
+
+func (s *ReadScanner) fail(msg string) bool {
+	s.err = &FormatError{Path: s.path, Line: s.line, Msg: msg}
+	return false
+}
+
+// nextLine gives the next non-blank line without its line break.
+func (s *ReadScanner) nextLine() (string, bool) {
+	if s.held {
+		s.held = false
+		return s.pending, true
+	}
+	for !s.eof {
+		line, err := s.r.ReadString('\n')
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			s.err = &FormatError{Path: s.path, Line: s.line + 1, Msg: err.Error()}
+			s.eof = true
+			return "", false
+		}
+		if line == "" && s.eof {
+			break
+		}
+		s.line++
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) != "" {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+func (s *ReadScanner) unread(line string) {
+	s.pending = line
+	s.held = true
+}
+
+// appendBases checks a sequence line and adds it, upper-cased, to b.
+func (s *ReadScanner) appendBases(b *strings.Builder, line string) bool {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+			return s.fail(fmt.Sprintf("invalid base %q at column %d", c, i+1))
+		}
+	}
+	b.WriteString(strings.ToUpper(line))
+	return true
+}
+
+func recordID(header string) string {
+	fields := strings.Fields(header[1:])
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// Scan reads the next record; it returns false at the end of the input or at
+// the first malformed record, which Err then reports.
+func (s *ReadScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	header, ok := s.nextLine()
+	if !ok {
+		return false
+	}
+	if s.fastq {
+		return s.scanFastq(header)
+	}
+	return s.scanFasta(header)
+}
+
+func (s *ReadScanner) scanFasta(header string) bool {
+	if !strings.HasPrefix(header, ">") {
+		return s.fail("expected '>' to start a FASTA record")
+	}
+	headerline := s.line
+	var seq strings.Builder
+	for {
+		line, ok := s.nextLine()
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(line, ">") {
+			s.unread(line)
+			break
+		}
+		if !s.appendBases(&seq, line) {
+			return false
+		}
+	}
+	if s.err != nil {
+		return false
+	}
+	if seq.Len() == 0 {
+		s.line = headerline
+		return s.fail("record without sequence")
+	}
+	s.read = Read{ID: recordID(header), Seq: seq.String()}
+	return true
+}
+
+func (s *ReadScanner) scanFastq(header string) bool {
+	if !strings.HasPrefix(header, "@") {
+		return s.fail("expected '@' to start a FASTQ record")
+	}
+	var seq strings.Builder
+	for {
+		line, ok := s.nextLine()
+		if !ok {
+			if s.err == nil {
+				s.fail("missing '+' line")
+			}
+			return false
+		}
+		if strings.HasPrefix(line, "+") {
+			break
+		}
+		if !s.appendBases(&seq, line) {
+			return false
+		}
+	}
+	if seq.Len() == 0 {
+		return s.fail("record without sequence")
+	}
+
+	// quality lines may start with '@' or '+', so they are taken by length
+	qual := make([]int, 0, seq.Len())
+	for len(qual) < seq.Len() {
+		line, ok := s.nextLine()
+		if !ok {
+			if s.err == nil {
+				s.fail(fmt.Sprintf("quality ends after %d of %d bases", len(qual), seq.Len()))
+			}
+			return false
+		}
+		if len(qual) > 0 && len(qual)+len(line) > seq.Len() {
+			return s.fail(fmt.Sprintf("quality ends after %d of %d bases", len(qual), seq.Len()))
+		}
+		for i := 0; i < len(line); i++ {
+			if line[i] < '!' || line[i] > '~' {
+				return s.fail(fmt.Sprintf("invalid quality %q at column %d", line[i], i+1))
+			}
+			qual = append(qual, int(line[i])-33)
+		}
+	}
+	if len(qual) != seq.Len() {
+		return s.fail(fmt.Sprintf("quality has %d values for %d bases", len(qual), seq.Len()))
+	}
+	s.read = Read{ID: recordID(header), Seq: seq.String(), Qual: qual}
+	return true
+}
+
+func (s *ReadScanner) Read() Read {
+	return s.read
+}
+
+func (s *ReadScanner) Err() error {
+	return s.err
+}
+
+func (s *ReadScanner) Close() error {
+	if s.gz != nil {
+		s.gz.Close()
+	}
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// LoadReads reads every record of a FASTA or FASTQ file, plain or gzip.
+func LoadReads(filepath string) ([]Read, error) {
+	s, err := OpenReads(filepath)
+	if err != nil {
+		return nil, err
+	}
+	return s.All()
+}
+
+// All reads the remaining records and closes s.
+func (s *ReadScanner) All() ([]Read, error) {
+	defer s.Close()
+	reads := make([]Read, 0)
+	for s.Scan() {
+		reads = append(reads, s.Read())
+	}
+	return reads, s.Err()
+}
+
+// ReadRecords gives the reads of a FASTA or FASTQ file and prints what is
+// wrong with it, if anything.
+func ReadRecords(filepath string) []Read {
+	reads, err := LoadReads(filepath)
+	if err != nil {
+		fmt.Println("Fail to read", filepath+":", err)
+	}
+	return reads
+}
+
+// CheckReads tells whether every read can be decoded: bases are upper-case
+// letters and qualities match them. Reads too long for a hypothesis are cut
+// by ClipReads instead.
+func CheckReads(reads []Read) error {
+	for i := 0; i < len(reads); i++ {
+		what := "read " + strconv.Itoa(i)
+		if reads[i].ID != "" {
+			what += " (" + reads[i].ID + ")"
+		}
+		if reads[i].Qual != nil && len(reads[i].Qual) != len(reads[i].Seq) {
+			return &LengthError{What: what + " quality", Got: len(reads[i].Qual), Want: len(reads[i].Seq)}
+		}
+		for j, c := range reads[i].Seq {
+			if c < 'A' || c > 'Z' {
+				return &BaseError{What: what, Pos: j, Base: c}
+			}
+		}
+	}
+	return nil
+}
+
+// ClipReads cuts the reads longer than MaxReadLen, such as chimeras, to their
+// first MaxReadLen bases so that positions fit a hypothesis, and marks them.
+// The reads passed in are left as they are.
+func ClipReads(reads []Read) ([]Read, []bool) {
+	clipped := make([]bool, len(reads))
+	res := reads
+	for i := 0; i < len(reads); i++ {
+		if len(reads[i].Seq) <= MaxReadLen {
+			continue
+		}
+		if &res[0] == &reads[0] {
+			res = append([]Read{}, reads...)
+		}
+		res[i] = reads[i].Slice(0, MaxReadLen)
+		clipped[i] = true
+	}
+	return res, clipped
+}
+
+func ReadSeqs(filepath string) []string {
+	return Seqs(ReadRecords(filepath))
+}
+
+func Seqs(reads []Read) []string {
+	res := make([]string, len(reads))
+	for i := range reads {
+		res[i] = reads[i].Seq
+	}
+	return res
+}
+
+func Quals(reads []Read) [][]int {
+	res := make([][]int, len(reads))
+	for i := range reads {
+		res[i] = reads[i].Qual
+	}
+	return res
+}
+
+// RevComp is the read of the other strand, qualities reversed with it.
+func (r Read) RevComp() Read {
+	res := Read{ID: r.ID, Seq: GenRevString(r.Seq)}
+	if r.Qual != nil {
+		res.Qual = make([]int, len(r.Qual))
+		for i := range r.Qual {
+			res.Qual[len(r.Qual)-1-i] = r.Qual[i]
+		}
+	}
+	return res
+}
+
+func (r Read) Slice(start int, end int) Read {
+	res := Read{ID: r.ID, Seq: r.Seq[start:end]}
+	if r.Qual != nil {
+		res.Qual = r.Qual[start:end]
+	}
+	return res
+}
+
+// WriteReads writes FASTQ when every read has qualities and FASTA otherwise;
+// reads without an ID are named by their index.
+func WriteReads(reads []Read, filepath string) error {
+	f, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	fastq := len(reads) > 0
+	for i := range reads {
+		if reads[i].Qual == nil {
+			fastq = false
+		}
+	}
+	for i, r := range reads {
+		id := r.ID
+		if id == "" {
+			id = "index_" + strconv.Itoa(i)
+		}
+		if !fastq {
+			_, err = w.WriteString(">" + id + "\n" + r.Seq + "\n")
+		} else {
+			qual := make([]byte, len(r.Qual))
+			for k, q := range r.Qual {
+				qual[k] = byte(min(q, 93) + 33)
+			}
+			_, err = w.WriteString("@" + id + "\n" + r.Seq + "\n+\n" + string(qual) + "\n")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,173 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, s string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestReadScanner(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		gz    bool
+		fastq bool
+		want  []Read
+	}{
+		{"empty", "", false, false, []Read{}},
+		{"fasta", ">r1\nACGT\n>r2\nTTGA\n", false, false, []Read{{ID: "r1", Seq: "ACGT"}, {ID: "r2", Seq: "TTGA"}}},
+		{"multi-line fasta", ">r1 first read\nACGT\nacg\n\n>r2\nTT\nG", false, false, []Read{{ID: "r1", Seq: "ACGTACG"}, {ID: "r2", Seq: "TTG"}}},
+		{"crlf fasta", ">r1\r\nAC\r\nGT\r\n", false, false, []Read{{ID: "r1", Seq: "ACGT"}}},
+		{"fastq", "@r1\nACGT\n+\nII#!\n", false, true, []Read{{ID: "r1", Seq: "ACGT", Qual: []int{40, 40, 2, 0}}}},
+		{"quality starting with @", "@r1\nACG\n+\n@II\n@r2\nA\n+\n5\n", false, true, []Read{
+			{ID: "r1", Seq: "ACG", Qual: []int{31, 40, 40}},
+			{ID: "r2", Seq: "A", Qual: []int{20}},
+		}},
+		{"quality starting with +", "@r1\nAC\n+r1\n+I\n", false, true, []Read{{ID: "r1", Seq: "AC", Qual: []int{10, 40}}}},
+		{"multi-line fastq", "@r1\nAC\nGT\n+\nII\n@+\n@r2\nA\n+\nI\n", false, true, []Read{
+			{ID: "r1", Seq: "ACGT", Qual: []int{40, 40, 31, 10}},
+			{ID: "r2", Seq: "A", Qual: []int{40}},
+		}},
+		{"gzip fasta", ">r1\nAC\nGT\n>r2\nA\n", true, false, []Read{{ID: "r1", Seq: "ACGT"}, {ID: "r2", Seq: "A"}}},
+		{"gzip fastq", "@r1\nACGT\n+\n@@II\n", true, true, []Read{{ID: "r1", Seq: "ACGT", Qual: []int{31, 31, 40, 40}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tt.input
+			if tt.gz {
+				input = gzipped(t, input)
+			}
+			s, err := NewReadScanner(strings.NewReader(input), "reads")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.IsFastq() != tt.fastq {
+				t.Errorf("IsFastq() = %v, want %v", s.IsFastq(), tt.fastq)
+			}
+			reads, err := s.All()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(reads, tt.want) {
+				t.Errorf("reads = %v, want %v", reads, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadScannerFormatError(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		gz    bool
+		line  int
+		msg   string
+	}{
+		{"no record", "ACGT\n", false, 1, "expected '>' or '@'"},
+		{"invalid base", ">r1\nACGT\nAC-T\n", false, 3, "invalid base '-' at column 3"},
+		{"blank lines counted", ">r1\n\nAC\n\n>r2\nA!\n", false, 6, "invalid base '!'"},
+		{"fasta without sequence", ">r1\n>r2\nAC\n", false, 1, "record without sequence"},
+		{"missing +", "@r1\nACGT\n", false, 2, "missing '+' line"},
+		{"fastq without sequence", "@r1\n+\nII\n", false, 2, "record without sequence"},
+		{"short quality", "@r1\nACGT\n+\nII\n", false, 4, "quality ends after 2 of 4 bases"},
+		{"quality runs over", "@r1\nACGT\n+\nII\nIII\n", false, 5, "quality ends after 2 of 4 bases"},
+		{"long quality", "@r1\nACG\n+\nIIII\n", false, 4, "quality has 4 values for 3 bases"},
+		{"invalid quality", "@r1\nAC\n+\nI \n", false, 4, "invalid quality ' ' at column 2"},
+		{"second record", "@r1\nA\n+\nI\nr2\nA\n", false, 5, "expected '@'"},
+		{"gzip", "@r1\nACGT\n+\nIIII\n@r2\nAC\n+\nI\n", true, 8, "quality ends after 1 of 2 bases"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tt.input
+			if tt.gz {
+				input = gzipped(t, input)
+			}
+			s, err := NewReadScanner(strings.NewReader(input), "reads")
+			if err == nil {
+				_, err = s.All()
+			}
+			var ferr *FormatError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("err = %v, want a FormatError", err)
+			}
+			if ferr.Path != "reads" || ferr.Line != tt.line || !strings.Contains(ferr.Msg, tt.msg) {
+				t.Errorf("err = %v, want reads:%d: %s", err, tt.line, tt.msg)
+			}
+		})
+	}
+}
+
+func TestLoadReadsGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reads.fq.gz")
+	if err := os.WriteFile(path, []byte(gzipped(t, "@r1\nAC\n+\nI+\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reads, err := LoadReads(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Read{{ID: "r1", Seq: "AC", Qual: []int{40, 10}}}
+	if !reflect.DeepEqual(reads, want) {
+		t.Errorf("reads = %v, want %v", reads, want)
+	}
+}
+
+func TestClipReads(t *testing.T) {
+	long := strings.Repeat("ACGT", MaxReadLen/4+1)
+	reads := []Read{{ID: "r1", Seq: "ACGT"}, {ID: "r2", Seq: long, Qual: make([]int, len(long))}}
+	res, clipped := ClipReads(reads)
+	if !reflect.DeepEqual(clipped, []bool{false, true}) {
+		t.Errorf("clipped = %v, want [false true]", clipped)
+	}
+	if len(res[1].Seq) != MaxReadLen || len(res[1].Qual) != MaxReadLen || res[1].Seq != long[:MaxReadLen] {
+		t.Errorf("clipped read has length %d and %d qualities, want %d", len(res[1].Seq), len(res[1].Qual), MaxReadLen)
+	}
+	if reads[1].Seq != long {
+		t.Error("ClipReads changed the reads passed in")
+	}
+	if err := CheckReads(res); err != nil {
+		t.Error(err)
+	}
+}
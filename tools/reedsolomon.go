@@ -0,0 +1,307 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"fmt"
+	"sync"
+)
+
+// OuterCode is a Reed-Solomon erasure code across strands. Every DataNum data
+// strands are followed by ParityNum parity strands, so any ParityNum lost
+// strands of a group can be rebuilt. Symbols are SymbolBits wide, taken from
+// the same position of each payload; the last PayloadLen % SymbolBits payload
+// bits are left as zeros.
+type OuterCode struct {
+	DataNum   int
+	ParityNum int
+}
+
+const OuterMaxNum = 255
+
+var GFPoly = map[int]int{
+	8:  0x11d,
+	9:  0x211,
+	10: 0x409,
+	11: 0x805,
+	12: 0x1053,
+	13: 0x201b,
+	14: 0x4443,
+	15: 0x8003,
+	16: 0x1100b,
+}
+
+type GF struct {
+	Bits int
+	Exp  []int
+	Log  []int
+}
+
+var gfCache sync.Map
+
+func GenGF(bits int) *GF {
+	if f, ok := gfCache.Load(bits); ok {
+		return f.(*GF)
+	}
+	size := 1 << bits
+	f := &GF{Bits: bits, Exp: make([]int, 2*size), Log: make([]int, size)}
+	x := 1
+	for i := 0; i < size-1; i++ {
+		f.Exp[i] = x
+		f.Log[x] = i
+		x <<= 1
+		if x&size != 0 {
+			x ^= GFPoly[bits]
+		}
+	}
+	for i := size - 1; i < 2*size; i++ {
+		f.Exp[i] = f.Exp[i-(size-1)]
+	}
+	gfCache.Store(bits, f)
+	return f
+}
+
+func (f *GF) Mul(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return f.Exp[f.Log[a]+f.Log[b]]
+}
+
+func (f *GF) Inv(a int) int {
+	return f.Exp[(1<<f.Bits)-1-f.Log[a]]
+}
+
+func (oc OuterCode) Validate() error {
+	if oc.DataNum < 0 || oc.DataNum > OuterMaxNum || oc.ParityNum < 0 || oc.ParityNum > OuterMaxNum {
+		return &ParamsError{Msg: fmt.Sprintf("Reed-Solomon group %d and parity %d not in [0, %d]", oc.DataNum, oc.ParityNum, OuterMaxNum)}
+	}
+	return nil
+}
+
+func (oc OuterCode) Enabled() bool {
+	return oc.DataNum > 0 && oc.ParityNum > 0
+}
+
+// SymbolBits picks the width in [8, 16] that wastes the fewest payload bits.
+func (oc OuterCode) SymbolBits(payloadLen int) int {
+	best := 0
+	for w := 8; w <= 16; w++ {
+		if 1<<w < oc.DataNum+oc.ParityNum {
+			continue
+		}
+		if best == 0 || payloadLen%w < payloadLen%best {
+			best = w
+		}
+	}
+	return best
+}
+
+// BlockBits is how many bits of the file each data strand carries.
+func (oc OuterCode) BlockBits(payloadLen int) int {
+	if !oc.Enabled() {
+		return payloadLen
+	}
+	return payloadLen - payloadLen%oc.SymbolBits(payloadLen)
+}
+
+// BlockID gives the strand of the dataindex-th data block.
+func (oc OuterCode) BlockID(dataindex int) int {
+	if !oc.Enabled() {
+		return dataindex
+	}
+	return dataindex/oc.DataNum*(oc.DataNum+oc.ParityNum) + dataindex%oc.DataNum
+}
+
+func (oc OuterCode) StrandNum(datanum int) int {
+	if !oc.Enabled() {
+		return datanum
+	}
+	return datanum + (datanum+oc.DataNum-1)/oc.DataNum*oc.ParityNum
+}
+
+func (oc OuterCode) DataNumOf(strandnum int) int {
+	if !oc.Enabled() {
+		return strandnum
+	}
+	groupLen := oc.DataNum + oc.ParityNum
+	return strandnum - (strandnum+groupLen-1)/groupLen*oc.ParityNum
+}
+
+func (oc OuterCode) coef(f *GF, parity, data int) int {
+	return f.Inv(parity ^ (oc.ParityNum + data))
+}
+
+// Parity returns the ParityNum parity payloads of one group of data payloads.
+func (oc OuterCode) Parity(payloads []Bitset, params Params) []Bitset {
+	w := oc.SymbolBits(params.PayloadLen)
+	f := GenGF(w)
+	symbols := params.PayloadLen / w
+	res := make([]Bitset, oc.ParityNum)
+	for j := 0; j < oc.ParityNum; j++ {
+		res[j] = NewBitset(params.PayloadLen)
+		for s := 0; s < symbols; s++ {
+			val := 0
+			for i := 0; i < len(payloads); i++ {
+				val ^= f.Mul(oc.coef(f, j, i), int(payloads[i].Uint(s*w, (s+1)*w)))
+			}
+			res[j].writeUint(s*w, w, uint64(val))
+		}
+	}
+	return res
+}
+
+// Recover takes blocks sorted by BlockID, where failed ones have no payload,
+// and returns the data blocks in file order with lost ones rebuilt from parity
+// where the group allows it.
+func (oc OuterCode) Recover(blocks []Block, params Params) ([]Block, int) {
+	datanum := oc.DataNumOf(len(blocks))
+	res := make([]Block, datanum)
+	recovered := 0
+	groupLen := oc.DataNum + oc.ParityNum
+	for g := 0; g*groupLen < len(blocks); g++ {
+		start := g * groupLen
+		k := oc.DataNum
+		if start+groupLen > len(blocks) {
+			k = len(blocks) - start - oc.ParityNum
+		}
+		if k <= 0 {
+			break
+		}
+
+		lost := make([]int, 0)
+		for i := 0; i < k; i++ {
+			res[g*oc.DataNum+i] = blocks[start+i]
+			if len(blocks[start+i].Payload) == 0 {
+				lost = append(lost, i)
+			}
+		}
+		parity := make([]int, 0)
+		for j := 0; j < oc.ParityNum && len(parity) < len(lost); j++ {
+			if len(blocks[start+k+j].Payload) > 0 {
+				parity = append(parity, j)
+			}
+		}
+		if len(lost) == 0 || len(parity) < len(lost) {
+			continue
+		}
+
+		payloads := make([]Bitset, k)
+		for i := 0; i < k; i++ {
+			payloads[i] = ReshapePayload(blocks[start+i].Payload, params)
+		}
+		parityPayloads := make([]Bitset, len(parity))
+		for a := 0; a < len(parity); a++ {
+			parityPayloads[a] = ReshapePayload(blocks[start+k+parity[a]].Payload, params)
+		}
+		for b, p := range oc.solve(payloads, lost, parity, parityPayloads, params) {
+			index := g*oc.DataNum + lost[b]
+			res[index] = Block{BlockID: oc.BlockID(index), Payload: []Bitset{p}}
+			recovered++
+		}
+	}
+	return res, recovered
+}
+
+// solve finds the lost data payloads from as many parity payloads.
+func (oc OuterCode) solve(payloads []Bitset, lost []int, parity []int, parityPayloads []Bitset, params Params) []Bitset {
+	w := oc.SymbolBits(params.PayloadLen)
+	f := GenGF(w)
+	symbols := params.PayloadLen / w
+	e := len(lost)
+
+	islost := make([]bool, len(payloads))
+	for _, i := range lost {
+		islost[i] = true
+	}
+
+	// matrix rows are the chosen parity strands, columns the lost data strands
+	matrix := make([][]int, e)
+	rhs := make([][]int, e)
+	for a := 0; a < e; a++ {
+		matrix[a] = make([]int, e)
+		for b := 0; b < e; b++ {
+			matrix[a][b] = oc.coef(f, parity[a], lost[b])
+		}
+		rhs[a] = make([]int, symbols)
+		for s := 0; s < symbols; s++ {
+			val := int(parityPayloads[a].Uint(s*w, (s+1)*w))
+			for i := 0; i < len(payloads); i++ {
+				if !islost[i] {
+					val ^= f.Mul(oc.coef(f, parity[a], i), int(payloads[i].Uint(s*w, (s+1)*w)))
+				}
+			}
+			rhs[a][s] = val
+		}
+	}
+
+	// Gauss-Jordan, every square submatrix of a Cauchy matrix is invertible
+	for c := 0; c < e; c++ {
+		pivot := c
+		for matrix[pivot][c] == 0 {
+			pivot++
+		}
+		matrix[c], matrix[pivot] = matrix[pivot], matrix[c]
+		rhs[c], rhs[pivot] = rhs[pivot], rhs[c]
+		inv := f.Inv(matrix[c][c])
+		for b := 0; b < e; b++ {
+			matrix[c][b] = f.Mul(matrix[c][b], inv)
+		}
+		for s := 0; s < symbols; s++ {
+			rhs[c][s] = f.Mul(rhs[c][s], inv)
+		}
+		for a := 0; a < e; a++ {
+			if a == c || matrix[a][c] == 0 {
+				continue
+			}
+			factor := matrix[a][c]
+			for b := 0; b < e; b++ {
+				matrix[a][b] ^= f.Mul(factor, matrix[c][b])
+			}
+			for s := 0; s < symbols; s++ {
+				rhs[a][s] ^= f.Mul(factor, rhs[c][s])
+			}
+		}
+	}
+
+	res := make([]Bitset, e)
+	for b := 0; b < e; b++ {
+		res[b] = NewBitset(params.PayloadLen)
+		for s := 0; s < symbols; s++ {
+			res[b].writeUint(s*w, w, uint64(rhs[b][s]))
+		}
+	}
+	return res
+}
+
+// BlocksintoData concatenates the file bits of data blocks.
+func BlocksintoData(blocks []Block, blockbits int, params Params) Bitset {
+	bits := NewBitset(0)
+	for i := 0; i < len(blocks); i++ {
+		bits.Append(ReshapePayload(blocks[i].Payload, params).Slice(0, blockbits))
+	}
+	return bits
+}
@@ -0,0 +1,163 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestGF(t *testing.T) {
+	for bits := range GFPoly {
+		f := GenGF(bits)
+		size := 1 << bits
+		seen := make([]bool, size)
+		for i := 0; i < size-1; i++ {
+			if seen[f.Exp[i]] {
+				t.Fatalf("GF(2^%d): %d appears twice among the powers", bits, f.Exp[i])
+			}
+			seen[f.Exp[i]] = true
+		}
+		rng := rand.New(rand.NewSource(int64(bits)))
+		for n := 0; n < 1000; n++ {
+			a, b, c := 1+rng.Intn(size-1), rng.Intn(size), rng.Intn(size)
+			if got := f.Mul(a, f.Inv(a)); got != 1 {
+				t.Fatalf("GF(2^%d): %d * Inv(%d) = %d, want 1", bits, a, a, got)
+			}
+			if f.Mul(a, 1) != a || f.Mul(a, 0) != 0 {
+				t.Fatalf("GF(2^%d): 1 and 0 are not the identities of %d", bits, a)
+			}
+			if f.Mul(a, b) != f.Mul(b, a) {
+				t.Fatalf("GF(2^%d): %d * %d does not commute", bits, a, b)
+			}
+			if f.Mul(a, b^c) != f.Mul(a, b)^f.Mul(a, c) {
+				t.Fatalf("GF(2^%d): %d * (%d + %d) does not distribute", bits, a, b, c)
+			}
+			if f.Mul(f.Mul(a, b), c) != f.Mul(a, f.Mul(b, c)) {
+				t.Fatalf("GF(2^%d): %d * %d * %d does not associate", bits, a, b, c)
+			}
+		}
+	}
+}
+
+// outerPool encodes datanum random data blocks with their parity, as the
+// stream encoder does, and returns the strands in BlockID order with the data.
+func outerPool(oc OuterCode, datanum int, params Params, seed int64) ([]Block, Bitset) {
+	rng := rand.New(rand.NewSource(seed))
+	blockbits := oc.BlockBits(params.PayloadLen)
+	data := NewBitset(datanum * blockbits)
+	for i := 0; i < data.Len(); i++ {
+		data.Set(i, rng.Intn(2))
+	}
+	payloads := make([]Bitset, 0)
+	group := make([]Bitset, 0)
+	for i := 0; i < datanum; i++ {
+		payload := data.Slice(i*blockbits, (i+1)*blockbits)
+		payload.Grow(params.PayloadLen)
+		payloads = append(payloads, payload)
+		group = append(group, payload)
+		if len(group) == oc.DataNum || i == datanum-1 {
+			payloads = append(payloads, oc.Parity(group, params)...)
+			group = group[:0]
+		}
+	}
+	blocks := make([]Block, len(payloads))
+	for i := range payloads {
+		blocks[i] = GenBlock(i, payloads[i], params)
+	}
+	return blocks, data
+}
+
+func TestRecover(t *testing.T) {
+	paramsRaw := GenParamsRaw(20, 80)
+	params, err := paramsRaw.Compile(Gungnir_Default_Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		oc      OuterCode
+		datanum int
+		lost    []int // BlockIDs
+		// data blocks left empty, in file order
+		unrecovered []int
+	}{
+		{"no loss", OuterCode{DataNum: 8, ParityNum: 2}, 16, nil, nil},
+		{"one data strand", OuterCode{DataNum: 8, ParityNum: 2}, 16, []int{3}, nil},
+		{"as many data strands as parity", OuterCode{DataNum: 8, ParityNum: 2}, 16, []int{0, 7}, nil},
+		{"data and parity strands", OuterCode{DataNum: 8, ParityNum: 3}, 16, []int{2, 9, 12}, nil},
+		{"every group", OuterCode{DataNum: 4, ParityNum: 2}, 12, []int{0, 1, 7, 8, 12, 15}, nil},
+		{"short last group", OuterCode{DataNum: 8, ParityNum: 2}, 13, []int{10, 12}, nil},
+		{"parity strands only", OuterCode{DataNum: 8, ParityNum: 2}, 16, []int{8, 9}, nil},
+		{"more than parity", OuterCode{DataNum: 8, ParityNum: 2}, 16, []int{1, 2, 3, 11}, []int{1, 2, 3}},
+		{"wide symbols", OuterCode{DataNum: 255, ParityNum: 4}, 300, []int{0, 100, 254, 258}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, data := outerPool(tt.oc, tt.datanum, params, int64(len(tt.name)))
+			if len(blocks) != tt.oc.StrandNum(tt.datanum) {
+				t.Fatalf("%d strands, StrandNum gives %d", len(blocks), tt.oc.StrandNum(tt.datanum))
+			}
+			for _, id := range tt.lost {
+				blocks[id] = Block{}
+			}
+			res, recovered := tt.oc.Recover(blocks, params)
+			if len(res) != tt.datanum {
+				t.Fatalf("%d data blocks, want %d", len(res), tt.datanum)
+			}
+			empty := make(map[int]bool)
+			for _, i := range tt.unrecovered {
+				empty[i] = true
+			}
+			wantRecovered := 0
+			groupLen := tt.oc.DataNum + tt.oc.ParityNum
+			for _, id := range tt.lost {
+				if id%groupLen < tt.oc.DataNum && !empty[id/groupLen*tt.oc.DataNum+id%groupLen] {
+					wantRecovered++
+				}
+			}
+			if recovered != wantRecovered {
+				t.Errorf("recovered %d, want %d", recovered, wantRecovered)
+			}
+			blockbits := tt.oc.BlockBits(params.PayloadLen)
+			for i := range res {
+				if empty[i] {
+					if len(res[i].Payload) > 0 {
+						t.Errorf("block %d rebuilt beyond the parity", i)
+					}
+					continue
+				}
+				if res[i].BlockID != tt.oc.BlockID(i) {
+					t.Errorf("block %d has BlockID %d, want %d", i, res[i].BlockID, tt.oc.BlockID(i))
+				}
+				got := BlocksintoData(res[i:i+1], blockbits, params)
+				if !got.Equal(data.Slice(i*blockbits, (i+1)*blockbits)) {
+					t.Errorf("block %d differs from the data", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const ReportJSON = "/report.json"
+const ReportTSV = "/report.tsv"
+
+// SearchStats follows the hypothesis search of one read. Expanded counts the
+// hypotheses given children, Peak the most distinct hypotheses at one depth
+// before pruning to Maxhypo, and HashRejects the children dropped by a
+// checkpoint hash at each depth. Penalty is that of the decoded strand, in
+// edits of Unit, or -1 while none was found. Candidates counts the strands
+// that reached MaxDepth in the last search to find any, RunnerUp is the
+// penalty of the second best, or -1, and Refused tells that the best was not
+// emitted for a Confidence below MinConfidence.
+type SearchStats struct {
+	Expanded    int64   `json:"expanded"`
+	Peak        int     `json:"peak_frontier"`
+	HashRejects []int64 `json:"hash_rejects"`
+	Penalty     int     `json:"penalty"`
+	Unit        int     `json:"unit"`
+	Candidates  int     `json:"candidates"`
+	RunnerUp    int     `json:"runner_up"`
+	Confidence  float64 `json:"confidence"`
+	Refused     bool    `json:"refused"`
+	Seconds     float64 `json:"seconds"`
+}
+
+func NewSearchStats(n int) []SearchStats {
+	res := make([]SearchStats, n)
+	for i := 0; i < n; i++ {
+		res[i].Penalty, res[i].RunnerUp = -1, -1
+	}
+	return res
+}
+
+// StatsAt is the stats of read i, nil when stats are not kept.
+func StatsAt(stats []SearchStats, i int) *SearchStats {
+	if stats == nil {
+		return nil
+	}
+	return &stats[i]
+}
+
+func (s *SearchStats) begin(cost ReadCost, params Params) time.Time {
+	if s != nil {
+		s.Unit = cost.Unit
+		if s.HashRejects == nil {
+			s.HashRejects = make([]int64, params.MaxDepth+1)
+		}
+	}
+	return time.Now()
+}
+
+func (s *SearchStats) expand(hypos, frontier int) {
+	if s != nil {
+		s.Expanded += int64(hypos)
+		s.Peak = max(s.Peak, frontier)
+	}
+}
+
+// reject may be called from the threads of one read.
+func (s *SearchStats) reject(depth int) {
+	if s != nil {
+		atomic.AddInt64(&s.HashRejects[depth], 1)
+	}
+}
+
+func (s *SearchStats) end(start time.Time, penalty int, suc bool) {
+	if s != nil {
+		s.Seconds += time.Since(start).Seconds()
+		if suc {
+			s.Penalty = penalty
+		}
+	}
+}
+
+// Add takes in another search of the same read.
+func (s *SearchStats) Add(o SearchStats) {
+	s.Expanded += o.Expanded
+	s.Peak = max(s.Peak, o.Peak)
+	if s.HashRejects == nil {
+		s.HashRejects = make([]int64, len(o.HashRejects))
+	}
+	for i := 0; i < len(o.HashRejects) && i < len(s.HashRejects); i++ {
+		s.HashRejects[i] += o.HashRejects[i]
+	}
+	s.Seconds += o.Seconds
+	if o.Penalty >= 0 {
+		s.Penalty = o.Penalty
+		s.Unit = o.Unit
+	}
+	if o.Candidates > 0 {
+		s.Candidates, s.RunnerUp, s.Confidence, s.Refused = o.Candidates, o.RunnerUp, o.Confidence, o.Refused
+	}
+}
+
+// ReadReport is what became of one read over all rounds. Round counts the
+// rounds from 1 and, with Hmax and EDmax, tells the one the read decoded in;
+// they are 0 for reads that did not decode. The search stats add up the Tries
+// rounds that searched the read; header reads carry the manifest and are
+// never searched. Clipped reads were searched by their first MaxReadLen bases.
+type ReadReport struct {
+	Read     int    `json:"read"`
+	ID       string `json:"id"`
+	Header   bool   `json:"header"`
+	Clipped  bool   `json:"clipped"`
+	Decoded  bool   `json:"decoded"`
+	BlockID  int    `json:"block_id"`
+	Reversed bool   `json:"reversed"`
+	Round    int    `json:"round"`
+	Hmax     int    `json:"hmax"`
+	EDmax    int    `json:"edmax"`
+	Tries    int    `json:"tries"`
+	SearchStats
+}
+
+func NewReadReports(reads []Read) []ReadReport {
+	res := make([]ReadReport, len(reads))
+	for i := 0; i < len(reads); i++ {
+		res[i] = ReadReport{Read: i, ID: reads[i].ID, BlockID: -1, SearchStats: SearchStats{Penalty: -1, RunnerUp: -1}}
+	}
+	return res
+}
+
+// Record takes in a round that searched the read with stats, and whether its
+// block was kept.
+func (r *ReadReport) Record(stats SearchStats, kept bool, block int, reversed bool, round, Hmax, EDmax int) {
+	r.Tries++
+	r.Add(stats)
+	if kept {
+		r.Decoded, r.BlockID, r.Reversed = true, block, reversed
+		r.Round, r.Hmax, r.EDmax = round, Hmax, EDmax
+	} else {
+		r.Penalty = -1
+	}
+}
+
+// hashRejects lists the depths with rejections as depth:count.
+func (r ReadReport) hashRejects() string {
+	res := make([]string, 0)
+	for depth, n := range r.HashRejects {
+		if n > 0 {
+			res = append(res, strconv.Itoa(depth)+":"+strconv.FormatInt(n, 10))
+		}
+	}
+	if len(res) == 0 {
+		return "-"
+	}
+	return strings.Join(res, ",")
+}
+
+func WriteReportTSV(reports []ReadReport, w io.Writer) error {
+	tw := csv.NewWriter(w)
+	tw.Comma = '\t'
+	tw.Write([]string{"read", "id", "header", "clipped", "decoded", "block_id", "reversed", "round", "hmax", "edmax", "tries",
+		"penalty", "unit", "candidates", "runner_up", "confidence", "refused", "expanded", "peak_frontier",
+		"hash_rejects", "seconds"})
+	for _, r := range reports {
+		tw.Write([]string{strconv.Itoa(r.Read), r.ID, strconv.FormatBool(r.Header), strconv.FormatBool(r.Clipped), strconv.FormatBool(r.Decoded),
+			strconv.Itoa(r.BlockID), strconv.FormatBool(r.Reversed), strconv.Itoa(r.Round), strconv.Itoa(r.Hmax),
+			strconv.Itoa(r.EDmax), strconv.Itoa(r.Tries), strconv.Itoa(r.Penalty), strconv.Itoa(r.Unit),
+			strconv.Itoa(r.Candidates), strconv.Itoa(r.RunnerUp), strconv.FormatFloat(r.Confidence, 'f', 4, 64),
+			strconv.FormatBool(r.Refused), strconv.FormatInt(r.Expanded, 10), strconv.Itoa(r.Peak), r.hashRejects(),
+			strconv.FormatFloat(r.Seconds, 'f', 3, 64)})
+	}
+	tw.Flush()
+	return tw.Error()
+}
+
+// WriteReport writes the reports to ReportJSON and ReportTSV under outputpath.
+func WriteReport(reports []ReadReport, outputpath string) error {
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputpath+ReportJSON, data, 0644); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := WriteReportTSV(reports, &buf); err != nil {
+		return err
+	}
+	return os.WriteFile(outputpath+ReportTSV, buf.Bytes(), 0644)
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import "math"
+
+// KmerCost prices each edit type by its log-likelihood in the context of the
+// last KmerSize strand bases, in units of QualityUnit for an edit as likely
+// as the mean of its type. Rare edits cost up to twice a full edit.
+type KmerCost struct {
+	X []int
+	I []int
+	D []int
+}
+
+const KmerMask = 1<<(2*KmerSize) - 1
+
+// KmerIndex packs the last KmerSize bases of s as a Hypothesis tracks them.
+func KmerIndex(s string) int {
+	res := 0
+	for _, c := range s {
+		res = ((res << 2) + Nuc2Int(c)) & KmerMask
+	}
+	return res
+}
+
+// KmerString is the k-mer of a KmerIndex.
+func KmerString(index int) string {
+	res := make([]byte, KmerSize)
+	for i := KmerSize - 1; i >= 0; i-- {
+		res[i] = "ACTG"[index&3]
+		index >>= 2
+	}
+	return string(res)
+}
+
+// NewKmerCost quantizes the rates of data, as Readjson sums them over the
+// KmerSize position tables. Contexts missing from data cost the most.
+func NewKmerCost(data map[string]Kmer) *KmerCost {
+	t := &KmerCost{X: make([]int, KmerMask+1), I: make([]int, KmerMask+1), D: make([]int, KmerMask+1)}
+	var xs, is, ds []float64
+	var keys []int
+	for key, k := range data {
+		if len(key) != KmerSize {
+			continue
+		}
+		keys = append(keys, KmerIndex(key))
+		xs = append(xs, k.X_rate)
+		is = append(is, k.I_rate)
+		ds = append(ds, k.D_rate)
+	}
+	for _, c := range []struct {
+		table []int
+		rates []float64
+	}{{t.X, xs}, {t.I, is}, {t.D, ds}} {
+		for i := range c.table {
+			c.table[i] = 2 * QualityUnit
+		}
+		ref := 0.0
+		for _, p := range c.rates {
+			ref += p
+		}
+		if len(c.rates) == 0 || ref <= 0 {
+			for i := range c.table {
+				c.table[i] = QualityUnit
+			}
+			continue
+		}
+		ref = math.Log(ref / float64(len(c.rates)))
+		for j, p := range c.rates {
+			if p > 0 && p < 1 {
+				cost := int(math.Round(QualityUnit * math.Log(p) / ref))
+				c.table[keys[j]] = max(1, min(cost, 2*QualityUnit))
+			}
+		}
+	}
+	return t
+}
+
+// WithScoring prices edits by t, or by unit costs when t is nil. Gungnir-Trit
+// does not track the context and always keeps unit costs.
+func (params Params) WithScoring(t *KmerCost) Params {
+	params.Scoring = t
+	if params.Option == Gungnir_Trit_Params {
+		params.Scoring = nil
+	}
+	return params
+}
@@ -28,14 +28,53 @@ package tools
 import (
 	"math"
 	"math/rand"
+	"sync"
 )
 
-var (
-	subRand = rand.New(rand.NewSource(1))
-	insRand = rand.New(rand.NewSource(2))
-	delRand = rand.New(rand.NewSource(3))
+// Noise seeds the error simulation. Every strand draws from its own
+// generator, derived from Seed and the index of the strand, so the reads do
+// not depend on Threads, the number of strands handled at once. Model
+// shapes the errors drawn per base, with Bernoulli or a profile.
+type Noise struct {
+	Seed      int64
+	Threads   int
+	Bernoulli bool
+	Model     ErrorModel
+}
+
+// Generators of the steps that draw for the whole pool rather than a strand.
+const (
+	distributeStream = -1 - iota
+	splitStream
+	coverageStream
+	flipStream
+	chimeraStream
 )
 
+// StrandRand gives the generator of strand index in a run seeded with seed;
+// negative indices are the streams of whole-pool steps.
+func StrandRand(seed int64, index int) *rand.Rand {
+	return rand.New(rand.NewSource(int64(mix64(uint64(seed) ^ mix64(uint64(index)+1)))))
+}
+
+// mutate gives f(i, r) for every strand i, r its own generator.
+func (n Noise) mutate(count int, f func(i int, r *rand.Rand) string) []string {
+	res := make([]string, count)
+	threads := max(1, min(n.Threads, count))
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for t := 0; t < threads; t++ {
+		go func(t int) {
+			defer wg.Done()
+			for i := t; i < count; i += threads {
+				res[i] = f(i, StrandRand(n.Seed, i))
+			}
+		}(t)
+	}
+	wg.Wait()
+	return res
+}
+
 func ExistanceInt(r int, s []int) bool {
 	for i := 0; i < len(s); i++ {
 		if r == s[i] {
@@ -51,18 +90,18 @@ func deepCopyString(s string) string {
 	return string(newBytes)
 }
 
-func Substitutions(strand string) string {
+func Substitutions(strand string, r *rand.Rand) string {
 	runes := []rune(strand)
-	pos := subRand.Intn(len(strand))
+	pos := r.Intn(len(strand))
 	base_Int := Nuc2Int(runes[pos])
-	base := (subRand.Intn(3) + base_Int + 1) & 3
+	base := (r.Intn(3) + base_Int + 1) & 3
 	runes[pos] = Int2Nuc(base)
 	return string(runes)
 }
 
-func Insertions(strand string) string {
-	pos := insRand.Intn(len(strand) + 1)
-	base := insRand.Intn(4)
+func Insertions(strand string, r *rand.Rand) string {
+	pos := r.Intn(len(strand) + 1)
+	base := r.Intn(4)
 	runes := []rune(strand)
 	if pos == len(strand) {
 		runes = append(runes, Int2Nuc(base))
@@ -73,16 +112,14 @@ func Insertions(strand string) string {
 	return string(runes)
 }
 
-func Deletions(strand string) string {
-	pos := delRand.Intn(len(strand))
+func Deletions(strand string, r *rand.Rand) string {
+	pos := r.Intn(len(strand))
 	runes := []rune(strand)
 	runes = append(runes[:pos], runes[pos+1:]...)
 	return string(runes)
 }
 
-func SplitThree(n int) ([]int, []int, []int) {
-	splitrand := rand.New(rand.NewSource(42))
-
+func SplitThree(n int, splitrand *rand.Rand) ([]int, []int, []int) {
 	nums := make([]int, n)
 	for i := range nums {
 		nums[i] = i
@@ -117,60 +154,64 @@ func SplitThree(n int) ([]int, []int, []int) {
 	return set1, set2, set3
 }
 
-func AddErrorforseqs(s []string, errornum int) []string {
-	res := make([]string, len(s))
+func (n Noise) AddErrorforseqs(s []string, errornum int) []string {
+	sub := make([]int, len(s))
+	del := make([]int, len(s))
+	ins := make([]int, len(s))
 	base_err := errornum / 3
 	reminder := errornum % 3
 	if reminder == 0 {
 		for i := 0; i < len(s); i++ {
-			res[i] = AddErrorWithFixNum(s[i], base_err, base_err, base_err)
+			sub[i], del[i], ins[i] = base_err, base_err, base_err
 		}
 	} else if reminder == 1 {
-		set1, set2, set3 := SplitThree(len(s))
+		set1, set2, set3 := SplitThree(len(s), StrandRand(n.Seed, splitStream))
 		for i := 0; i < len(set1); i++ {
-			res[set1[i]] = AddErrorWithFixNum(s[set1[i]], base_err+1, base_err, base_err)
+			sub[set1[i]], del[set1[i]], ins[set1[i]] = base_err+1, base_err, base_err
 		}
 		for i := 0; i < len(set2); i++ {
-			res[set2[i]] = AddErrorWithFixNum(s[set2[i]], base_err, base_err+1, base_err)
+			sub[set2[i]], del[set2[i]], ins[set2[i]] = base_err, base_err+1, base_err
 		}
 		for i := 0; i < len(set3); i++ {
-			res[set3[i]] = AddErrorWithFixNum(s[set3[i]], base_err, base_err, base_err+1)
+			sub[set3[i]], del[set3[i]], ins[set3[i]] = base_err, base_err, base_err+1
 		}
 	} else if reminder == 2 {
-		set1, set2, set3 := SplitThree(len(s))
+		set1, set2, set3 := SplitThree(len(s), StrandRand(n.Seed, splitStream))
 		for i := 0; i < len(set1); i++ {
-			res[set1[i]] = AddErrorWithFixNum(s[set1[i]], base_err, base_err+1, base_err+1)
+			sub[set1[i]], del[set1[i]], ins[set1[i]] = base_err, base_err+1, base_err+1
 		}
 		for i := 0; i < len(set2); i++ {
-			res[set2[i]] = AddErrorWithFixNum(s[set2[i]], base_err+1, base_err, base_err+1)
+			sub[set2[i]], del[set2[i]], ins[set2[i]] = base_err+1, base_err, base_err+1
 		}
 		for i := 0; i < len(set3); i++ {
-			res[set3[i]] = AddErrorWithFixNum(s[set3[i]], base_err+1, base_err+1, base_err)
+			sub[set3[i]], del[set3[i]], ins[set3[i]] = base_err+1, base_err+1, base_err
 		}
 	}
-	return res
+	return n.mutate(len(s), func(i int, r *rand.Rand) string {
+		return AddErrorWithFixNum(s[i], sub[i], del[i], ins[i], r)
+	})
 }
 
-func AddErrorWithFixNum(s string, sub, del, ins int) string {
+func AddErrorWithFixNum(s string, sub, del, ins int, r *rand.Rand) string {
 	res := deepCopyString(s)
 	for i := 0; i < ins; i++ {
-		res = Insertions(res)
+		res = Insertions(res, r)
 	}
 	for i := 0; i < sub; i++ {
-		res = Substitutions(res)
+		res = Substitutions(res, r)
 	}
 	for i := 0; i < del; i++ {
-		res = Deletions(res)
+		res = Deletions(res, r)
 	}
 	return res
 }
 
-func DistributeErrs(n, sub, ins, del int) ([]int, []int, []int) {
+func DistributeErrs(n, sub, ins, del int, seed int64) ([]int, []int, []int) {
 	subpos := make([]int, 0)
 	inspos := make([]int, 0)
 	delpos := make([]int, 0)
 
-	Newrand := rand.New(rand.NewSource(7))
+	Newrand := StrandRand(seed, distributeStream)
 
 	perm := Newrand.Perm(n)
 	count := 0
@@ -191,7 +232,6 @@ func DistributeErrs(n, sub, ins, del int) ([]int, []int, []int) {
 		}
 	}
 
-	Newrand = rand.New(rand.NewSource(8))
 	perm = Newrand.Perm(n)
 
 	for i := 0; i < n; i++ {
@@ -206,7 +246,6 @@ func DistributeErrs(n, sub, ins, del int) ([]int, []int, []int) {
 		}
 	}
 
-	Newrand = rand.New(rand.NewSource(9))
 	perm = Newrand.Perm(n)
 
 	for i := 0; i < n; i++ {
@@ -220,10 +259,59 @@ func DistributeErrs(n, sub, ins, del int) ([]int, []int, []int) {
 	return subpos, inspos, delpos
 }
 
-func AddError(s []string, subrate, delrate, insrate, errrate float64) []string {
+// Poisson draws how many reads a strand gets, some strands get none. Large
+// means, where exp(-mean) underflows, are drawn from the normal approximation.
+func Poisson(mean float64, r *rand.Rand) int {
+	if mean <= 0 {
+		return 0
+	}
+	if mean > 500 {
+		return max(0, int(math.Round(mean+math.Sqrt(mean)*r.NormFloat64())))
+	}
+	limit := math.Exp(-mean)
+	k := 0
+	p := r.Float64()
+	for p > limit {
+		k++
+		p *= r.Float64()
+	}
+	return k
+}
+
+// SampleReads copies each strand coverage times on average, in random order.
+func (n Noise) SampleReads(s []string, coverage float64) []string {
+	res := make([]string, 0)
+	r := StrandRand(n.Seed, coverageStream)
+	for i := 0; i < len(s); i++ {
+		for k := Poisson(coverage, r); k > 0; k-- {
+			res = append(res, s[i])
+		}
+	}
+	r.Shuffle(len(res), func(i, j int) {
+		res[i], res[j] = res[j], res[i]
+	})
+	return res
+}
+
+// FlipReads turns a share of the reads into their reverse complement, as
+// sequencing reads either strand of the duplex.
+func (n Noise) FlipReads(s []string, rate float64) []string {
 	res := make([]string, len(s))
+	r := StrandRand(n.Seed, flipStream)
 	for i := 0; i < len(s); i++ {
-		res[i] = deepCopyString(s[i])
+		res[i] = s[i]
+		if r.Float64() < rate {
+			res[i] = GenRevString(s[i])
+		}
+	}
+	return res
+}
+
+// AddError spreads a fixed number of errors, the rates times the bases of
+// the pool, as evenly over the strands as it goes.
+func (n Noise) AddError(s []string, subrate, delrate, insrate, errrate float64) []string {
+	if len(s) == 0 {
+		return nil
 	}
 	nuc_num := len(s) * len(s[0])
 	Ins := int(math.Ceil(float64(nuc_num) * insrate))
@@ -236,9 +324,9 @@ func AddError(s []string, subrate, delrate, insrate, errrate float64) []string {
 	S_average := Sub / len(s)
 	S_reminder := Sub - len(s)*S_average
 
-	subpos, inspos, delpos := DistributeErrs(len(s), S_reminder, I_reminder, D_reminder)
+	subpos, inspos, delpos := DistributeErrs(len(s), S_reminder, I_reminder, D_reminder, n.Seed)
 
-	for i := 0; i < len(s); i++ {
+	return n.mutate(len(s), func(i int, r *rand.Rand) string {
 		ins := I_average
 		if ExistanceInt(i, inspos) {
 			ins += 1
@@ -251,8 +339,84 @@ func AddError(s []string, subrate, delrate, insrate, errrate float64) []string {
 		if ExistanceInt(i, subpos) {
 			sub += 1
 		}
-		res[i] = AddErrorWithFixNum(s[i], sub, del, ins)
+		return AddErrorWithFixNum(s[i], sub, del, ins, r)
+	})
+}
+
+// AddBernoulliError gives every base its own chance of each error, so the
+// number of errors in a strand varies, see ErrorModel.Mutate.
+func (n Noise) AddBernoulliError(s []string, subrate, delrate, insrate float64) []string {
+	return n.mutate(len(s), func(i int, r *rand.Rand) string {
+		read, _ := n.Model.Mutate(s[i], UniformRates(len(s[i]), subrate, insrate, delrate), 1, r)
+		return read
+	})
+}
+
+// BaseRates gives the X, I and D rates of every base of s, each the mean of
+// the profile tables over the k-mers that hold the base, at its position in
+// them. Bases in no k-mer of A, C, G and T get the mean rates of the profile.
+func BaseRates(s string, p *ErrorProfile) []Kmer {
+	var mean Kmer
+	for _, value := range p.Sum {
+		mean.X_rate += value.X_rate
+		mean.I_rate += value.I_rate
+		mean.D_rate += value.D_rate
 	}
+	n := float64(len(p.Sum) * len(p.Tables))
+	mean.X_rate /= n
+	mean.I_rate /= n
+	mean.D_rate /= n
 
+	res := make([]Kmer, len(s))
+	for pos := range s {
+		var rate Kmer
+		count := 0
+		for i := 0; i < len(p.Tables); i++ {
+			start := pos - i
+			if start < 0 || start+KmerSize > len(s) {
+				continue
+			}
+			value, ok := p.Tables[i][s[start:start+KmerSize]]
+			if !ok {
+				continue
+			}
+			rate.X_rate += value.X_rate
+			rate.I_rate += value.I_rate
+			rate.D_rate += value.D_rate
+			count++
+		}
+		if count == 0 {
+			rate = mean
+		} else {
+			rate.X_rate /= float64(count)
+			rate.I_rate /= float64(count)
+			rate.D_rate /= float64(count)
+		}
+		res[pos] = rate
+	}
+	return res
+}
+
+// AddKmerError draws the fate of every base from its rates in the profile,
+// scaled by scale, see ErrorModel.Mutate.
+func (n Noise) AddKmerError(s []string, p *ErrorProfile, scale float64) []string {
+	return n.mutate(len(s), func(i int, r *rand.Rand) string {
+		read, _ := n.Model.Mutate(s[i], BaseRates(s[i], p), scale, r)
+		return read
+	})
+}
+
+// MutateBases draws the fate of every base of s from its rates times scale,
+// each base on its own, see ErrorModel.Mutate.
+func MutateBases(s string, rates []Kmer, scale float64, r *rand.Rand) (string, []float64) {
+	return ErrorModel{}.Mutate(s, rates, scale, r)
+}
+
+// UniformRates gives every base of a strand of length n the same rates.
+func UniformRates(n int, sub, ins, del float64) []Kmer {
+	res := make([]Kmer, n)
+	for i := range res {
+		res[i] = Kmer{X_rate: sub, I_rate: ins, D_rate: del, E_rate: sub + ins + del}
+	}
 	return res
 }
@@ -0,0 +1,274 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"bufio"
+	"io"
+	"sync"
+
+	"github.com/spaolacci/murmur3"
+)
+
+const StreamChunkBytes = 1 << 16
+
+// StreamEncoder turns bytes into blocks and FASTA records without holding the
+// whole input. Without an outer code, BlockIDs and strands are the same as
+// BitsintoBlocks + Encode; with one, each group's parity strands follow it.
+type StreamEncoder struct {
+	params      Params
+	outer       OuterCode
+	blockbits   int
+	data        map[string]Kmer
+	writer      *bufio.Writer
+	threads_num int
+	maximumseq  int
+	maxbytes    int
+	pending     Bitset
+	group       []Bitset
+	blockID     int
+	datanum     int
+	filelen     int
+	indexlen    int
+	fountain    bool
+	digest      murmur3.Hash128
+}
+
+// maximumseq <= 0 means no limit on the number of data strands.
+func NewStreamEncoder(w io.Writer, params Params, outer OuterCode, maximumseq int, threads_num int) (*StreamEncoder, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if err := outer.Validate(); err != nil {
+		return nil, err
+	}
+	if err := CheckProfile(params); err != nil {
+		return nil, err
+	}
+	enc := &StreamEncoder{
+		params:      params,
+		outer:       outer,
+		blockbits:   outer.BlockBits(params.PayloadLen),
+		writer:      bufio.NewWriter(w),
+		threads_num: threads_num,
+		maximumseq:  maximumseq,
+		maxbytes:    -1,
+		pending:     NewBitset(0),
+		digest:      murmur3.New128(),
+	}
+	if enc.threads_num < 1 {
+		enc.threads_num = 1
+	}
+	if maximumseq > 0 {
+		enc.maxbytes = maximumseq * enc.blockbits / 8
+	}
+	if params.Option != Gungnir_Trit_Params {
+		enc.data = Profile()
+	}
+	return enc, nil
+}
+
+func (enc *StreamEncoder) Full() bool {
+	return enc.maximumseq > 0 && enc.datanum >= enc.maximumseq
+}
+
+// BlockNum is the number of data blocks written so far, parity not included.
+func (enc *StreamEncoder) BlockNum() int {
+	return enc.datanum
+}
+
+func (enc *StreamEncoder) Write(p []byte) (int, error) {
+	if enc.Full() {
+		return len(p), nil
+	}
+	hashed := p
+	if enc.maxbytes >= 0 && enc.filelen+len(hashed) > enc.maxbytes {
+		hashed = hashed[:enc.maxbytes-enc.filelen]
+	}
+	enc.digest.Write(hashed)
+	enc.filelen += len(hashed)
+
+	enc.pending.Append(BitsetFromBytes(p))
+	blocknum := enc.pending.Len() / enc.blockbits
+	if enc.maximumseq > 0 && enc.datanum+blocknum > enc.maximumseq {
+		blocknum = enc.maximumseq - enc.datanum
+	}
+	used := blocknum * enc.blockbits
+	err := enc.emit(enc.pending.Slice(0, used))
+
+	enc.pending = enc.pending.Slice(used, enc.pending.Len())
+	if enc.Full() {
+		enc.pending = NewBitset(0)
+	}
+	return len(p), err
+}
+
+// emit cuts bits into data blocks, adding the parity of every full group.
+func (enc *StreamEncoder) emit(bits Bitset) error {
+	blocknum := bits.Len() / enc.blockbits
+	payloads := make([]Bitset, 0)
+	for i := 0; i < blocknum; i++ {
+		payload := bits.Slice(i*enc.blockbits, (i+1)*enc.blockbits)
+		payload.Grow(enc.params.PayloadLen)
+		payloads = append(payloads, payload)
+		if enc.outer.Enabled() {
+			enc.group = append(enc.group, payload)
+			if len(enc.group) == enc.outer.DataNum {
+				payloads = append(payloads, enc.outer.Parity(enc.group, enc.params)...)
+				enc.group = nil
+			}
+		}
+	}
+	enc.datanum += blocknum
+	return enc.write(payloads)
+}
+
+// write encodes payloads in parallel and writes them in BlockID order.
+func (enc *StreamEncoder) write(payloads []Bitset) error {
+	blocknum := len(payloads)
+	dna := make([]string, blocknum)
+	errs := make([]error, blocknum)
+
+	var wg sync.WaitGroup
+	wg.Add(blocknum)
+	ch := make(chan struct{}, enc.threads_num)
+	for i := 0; i < blocknum; i++ {
+		index := i
+		ch <- struct{}{}
+		go func() {
+			b := GenBlock(enc.blockID+index, payloads[index], enc.params)
+			if enc.params.Option == Gungnir_Trit_Params {
+				dna[index], errs[index] = Block2DNA_Three(b, enc.params)
+			} else {
+				dna[index] = Block2DNA(b, enc.data, enc.params)
+			}
+			<-ch
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < blocknum; i++ {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		if err := WriteFastaRecord(enc.writer, enc.blockID+i, dna[i]); err != nil {
+			return err
+		}
+	}
+	enc.blockID += blocknum
+	return nil
+}
+
+func (enc *StreamEncoder) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	buf := make([]byte, StreamChunkBytes)
+	for !enc.Full() {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, werr := enc.Write(buf[:n]); werr != nil {
+				return total, werr
+			}
+			total += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Align pads the pending bits with zeros so that the next byte starts a new block.
+func (enc *StreamEncoder) Align() error {
+	var err error
+	if enc.pending.Len() > 0 && !enc.Full() {
+		last := enc.pending
+		last.Grow(enc.blockbits)
+		err = enc.emit(last)
+	}
+	enc.pending = NewBitset(0)
+	return err
+}
+
+// WriteIndex puts the archive index into its own blocks; it must be the last write.
+func (enc *StreamEncoder) WriteIndex(index []byte) error {
+	if err := enc.Align(); err != nil {
+		return err
+	}
+	enc.indexlen = len(index)
+	_, err := enc.Write(index)
+	return err
+}
+
+// Close pads the last block, appends the header strands and flushes.
+func (enc *StreamEncoder) Close() (Manifest, error) {
+	if err := enc.Align(); err != nil {
+		return Manifest{}, err
+	}
+	if len(enc.group) > 0 {
+		if err := enc.write(enc.outer.Parity(enc.group, enc.params)); err != nil {
+			return Manifest{}, err
+		}
+		enc.group = nil
+	}
+
+	var m Manifest
+	m.Option = enc.params.Option
+	m.HashLen = enc.params.HashLen
+	m.PayloadLen = enc.params.PayloadLen
+	m.FileLen = enc.filelen
+	m.StrandNum = enc.blockID
+	h1, h2 := enc.digest.Sum128()
+	m.Digest = DigestBytes(h1, h2)
+	m.IndexLen = enc.indexlen
+	m.Outer = enc.outer
+	m.Fountain = enc.fountain
+
+	header, err := m.Strands(enc.params.Primer)
+	if err != nil {
+		return m, err
+	}
+	for i := 0; i < len(header); i++ {
+		if err := WriteFastaRecord(enc.writer, enc.blockID+i, header[i]); err != nil {
+			return m, err
+		}
+	}
+	return m, enc.writer.Flush()
+}
+
+func EncodeStream(r io.Reader, w io.Writer, params Params, outer OuterCode, maximumseq int, threads_num int) (Manifest, error) {
+	enc, err := NewStreamEncoder(w, params, outer, maximumseq, threads_num)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if _, err := enc.ReadFrom(r); err != nil {
+		return Manifest{}, err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,84 @@
+// Copyright 2025 The University of Hong Kong, Department of Computer Science
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+//    notice, this list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright
+//    notice, this list of conditions and the following disclaimer in the
+//    documentation and/or other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the
+//    names of its contributors may be used to endorse or promote products
+//    derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY
+// DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+// (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+// LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+// ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package tools
+
+import (
+	"fmt"
+)
+
+// Raw reads carry adapters, primers and random flanks around the strand.
+// TrimFile cuts them down to the strand between the primers. Bases the
+// trimming leaves behind are taken by the decoder: with FlankLen, up to
+// FlankLen read bases before the first and after the last strand base cost
+// nothing, so they do not use up EDmax.
+
+// MaxFlankLenFree keeps the read within the 9 bits of the hypothesis index.
+const MaxFlankLenFree = 128
+
+func (params Params) WithFlank(flanklen int) Params {
+	params.FlankLen = flanklen
+	return params
+}
+
+// LeadFree tells whether skipping read base index before the first strand
+// base is free.
+func (params Params) LeadFree(depth int, index int) bool {
+	return depth == 0 && index < params.FlankLen
+}
+
+// TrimFile finds the primers of the pool at outputpath in each raw read, in
+// either orientation, and writes the strands between them to Add_Error with
+// their IDs and qualities. Reads without both primers are dropped.
+func TrimFile(readpath string, outputpath string) error {
+	p := ReadPrimers(outputpath)
+	if !p.Attached() {
+		return fmt.Errorf("no primers in %s, encode with -forward and -reverse", outputpath)
+	}
+	_, Error_Name, _ := Genfilename(outputpath)
+	reads, err := LoadReads(readpath)
+	if err != nil {
+		return fmt.Errorf("fail to read %s: %w", readpath, err)
+	}
+
+	trimmed := make([]Read, 0, len(reads))
+	reversed, dropped := 0, 0
+	for _, read := range reads {
+		strand, _, rev, ok := p.Orient(read)
+		if !ok {
+			dropped++
+			continue
+		}
+		if rev {
+			reversed++
+		}
+		trimmed = append(trimmed, strand)
+	}
+	if err := WriteReads(trimmed, Error_Name); err != nil {
+		return fmt.Errorf("fail to write %s: %w", Error_Name, err)
+	}
+	fmt.Println("Reads:", len(reads), " Trimmed:", len(trimmed), " Dropped:", dropped, " Reverse complemented:", reversed)
+	return nil
+}